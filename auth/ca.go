@@ -0,0 +1,80 @@
+package auth
+
+// CA certificates used to verify cmsweb server certificates.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCAPath defines default location of CERN/IGTF CA certificates
+const DefaultCAPath = "/etc/grid-security/certificates"
+
+// LoadCAs creates pool of CA certificates from system roots, given CA bundle
+// file and all certificates found in given CA directory
+func LoadCAs(cacert, capath string) (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	return roots, appendCAs(roots, cacert, capath)
+}
+
+// LoadClientCAs creates pool of CA certificates from given CA bundle file and
+// CA directory to verify client certificates, unlike LoadCAs it does not
+// include system roots
+func LoadClientCAs(cacert, capath string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	return pool, appendCAs(pool, cacert, capath)
+}
+
+// helper function to add certificates of given CA bundle file and CA
+// directory to given pool
+func appendCAs(roots *x509.CertPool, cacert, capath string) error {
+	if cacert != "" {
+		data, err := os.ReadFile(cacert)
+		if err != nil {
+			return fmt.Errorf("unable to read CA bundle: %v", err)
+		}
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no CA certificates found in %s", cacert)
+		}
+	}
+	if capath != "" {
+		files, err := os.ReadDir(capath)
+		if err != nil {
+			return fmt.Errorf("unable to read CA directory: %v", err)
+		}
+		var ncas int
+		for _, f := range files {
+			// CA directory contains certificates along with CRLs, signing
+			// policies, etc., AppendCertsFromPEM only picks up certificates
+			data, err := os.ReadFile(filepath.Join(capath, f.Name()))
+			if err != nil {
+				continue
+			}
+			if roots.AppendCertsFromPEM(data) {
+				ncas++
+			}
+		}
+		if ncas == 0 {
+			return fmt.Errorf("no CA certificates found in %s", capath)
+		}
+	}
+	return nil
+}
+
+// IsVerificationError checks if given error is caused by failed verification
+// of server certificate
+func IsVerificationError(err error) bool {
+	var verr *tls.CertificateVerificationError
+	var uerr x509.UnknownAuthorityError
+	var herr x509.HostnameError
+	var cerr x509.CertificateInvalidError
+	return errors.As(err, &verr) || errors.As(err, &uerr) ||
+		errors.As(err, &herr) || errors.As(err, &cerr)
+}
@@ -0,0 +1,51 @@
+package auth
+
+// HTTP client used by cmsweb exporters to talk to cmsweb data-services.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Options defines how HTTP client should be constructed
+type Options struct {
+	Namespace         string        // namespace of credential metrics
+	ProxyFile         string        // explicit proxy file, see ResolveCredential
+	NoCerts           bool          // do not use X509 certificates at all
+	Timeout           time.Duration // connection timeout, zero means no timeout
+	DisableKeepAlives bool          // disable HTTP keep-alives
+	CACert            string        // CA bundle file to verify server certificates
+	CAPath            string        // CA directory to verify server certificates
+	Insecure          bool          // skip verification of server certificates
+	Token             TokenOptions  // bearer token authentication
+}
+
+// helper function to parse leaf certificate of given TLS certificates
+func leafCertificate(certs []tls.Certificate) (*x509.Certificate, error) {
+	if len(certs) == 0 || len(certs[0].Certificate) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	if certs[0].Leaf != nil {
+		return certs[0].Leaf, nil
+	}
+	return x509.ParseCertificate(certs[0].Certificate[0])
+}
+
+// helper function to create HTTP transport with given certificates
+func newTransport(opts Options, certs []tls.Certificate, roots *x509.CertPool) *http.Transport {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{Certificates: certs,
+			RootCAs:            roots,
+			InsecureSkipVerify: opts.Insecure},
+		DisableKeepAlives: opts.DisableKeepAlives,
+	}
+	if opts.Timeout > 0 {
+		tr.DialContext = (&net.Dialer{Timeout: opts.Timeout}).DialContext
+		tr.IdleConnTimeout = time.Duration(1 * time.Second)
+	}
+	return tr
+}
@@ -0,0 +1,256 @@
+package auth
+
+// Credential manager which rebuilds HTTP transport when X509 files change.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Manager keeps HTTP transport of the exporter and transparently rebuilds it
+// whenever credential files are changed on disk, e.g. renewed by cron job
+type Manager struct {
+	opts      Options
+	mutex     sync.Mutex
+	transport *http.Transport
+	public    *http.Transport // transport without credentials
+	cred      Credential
+	stamps    map[string]time.Time // modification times of credential files
+	loaded    bool                 // credential was loaded at least once
+	lastErr   string               // last credential error we reported
+	leaf      *x509.Certificate    // leaf certificate of the credential
+	roots     *x509.CertPool       // CA certificates to verify servers
+	tokens    *tokenSource         // source of bearer tokens
+
+	reloads        prometheus.Counter
+	verifyFailures prometheus.Counter
+	notAfter       *prometheus.Desc
+	expiry         *prometheus.Desc
+	info           *prometheus.Desc
+}
+
+// NewManager creates new credential manager for given options
+func NewManager(opts Options) *Manager {
+	m := &Manager{
+		opts: opts,
+		reloads: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "x509_reloads_total",
+			Help:      "Number of times X509 credential was reloaded from disk",
+		}),
+		verifyFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "tls_verify_failures_total",
+			Help:      "Number of requests failed due to server certificate verification",
+		}),
+		notAfter: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "x509_not_after_timestamp_seconds"),
+			"NotAfter timestamp of X509 credential used by the exporter",
+			nil,
+			nil),
+		expiry: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "x509_expiry_seconds"),
+			"Number of seconds until X509 credential used by the exporter expires",
+			nil,
+			nil),
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "x509_info"),
+			"Information about X509 credential used by the exporter",
+			[]string{"subject", "issuer", "source"},
+			nil),
+	}
+	if opts.Insecure {
+		log.Println("WARNING: verification of server certificates is disabled")
+	} else {
+		roots, err := LoadCAs(opts.CACert, opts.CAPath)
+		if err != nil {
+			log.Println("unable to load CA certificates: ", err.Error())
+		}
+		m.roots = roots
+	}
+	m.transport = newTransport(opts, nil, m.roots)
+	m.public = newTransport(opts, nil, m.roots)
+	if opts.Token.Enabled() {
+		client := &http.Client{Transport: newTransport(opts, nil, m.roots), Timeout: opts.Timeout}
+		m.tokens = newTokenSource(opts.Token, client)
+	}
+	if !opts.NoCerts {
+		m.reload()
+	}
+	return m
+}
+
+// Client provides HTTP client which uses transport of the manager
+func (m *Manager) Client() *http.Client {
+	return &http.Client{Transport: m, Timeout: m.opts.Timeout}
+}
+
+// PublicClient provides HTTP client which verifies servers in the same way
+// as the client of the manager but sends neither X509 credential nor bearer
+// token, e.g. to probe arbitrary targets
+func (m *Manager) PublicClient() *http.Client {
+	return &http.Client{Transport: publicTransport{m}, Timeout: m.opts.Timeout}
+}
+
+// publicTransport sends requests without credentials via transport of the
+// manager without credentials
+type publicTransport struct {
+	m *Manager
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (t publicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.m.public.RoundTrip(req)
+	return t.m.verified(req, resp, err)
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (m *Manager) RoundTrip(req *http.Request) (*http.Response, error) {
+	if m.tokens != nil && m.opts.Token.Allowed(req) {
+		token, err := m.tokens.Token(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("unable to get bearer token: %w", err)
+		}
+		// RoundTripper should not modify original request
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := m.Transport().RoundTrip(req)
+	return m.verified(req, resp, err)
+}
+
+// helper function to count failed verifications of server certificates and
+// to explain them in error of given request
+func (m *Manager) verified(req *http.Request, resp *http.Response, err error) (*http.Response, error) {
+	if err != nil && IsVerificationError(err) {
+		m.verifyFailures.Inc()
+		return resp, fmt.Errorf("unable to verify server certificate of %s, please check -cacert/-capath options: %w", req.URL.Host, err)
+	}
+	return resp, err
+}
+
+// Transport returns current HTTP transport, it is rebuilt if credential
+// files were changed since last call
+func (m *Manager) Transport() *http.Transport {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.opts.NoCerts && m.changed() {
+		m.reload()
+	}
+	return m.transport
+}
+
+// Credential returns credential currently used by the manager
+func (m *Manager) Credential() Credential {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.cred
+}
+
+// Describe implements prometheus.Collector interface
+func (m *Manager) Describe(ch chan<- *prometheus.Desc) {
+	m.reloads.Describe(ch)
+	m.verifyFailures.Describe(ch)
+	ch <- m.notAfter
+	ch <- m.expiry
+	ch <- m.info
+}
+
+// Collect implements prometheus.Collector interface
+func (m *Manager) Collect(ch chan<- prometheus.Metric) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// pick up renewed credential even if nobody used the client yet
+	if !m.opts.NoCerts && m.changed() {
+		m.reload()
+	}
+	m.reloads.Collect(ch)
+	m.verifyFailures.Collect(ch)
+	if m.leaf == nil {
+		return
+	}
+	notAfter := m.leaf.NotAfter
+	ch <- prometheus.MustNewConstMetric(m.notAfter, prometheus.GaugeValue, float64(notAfter.Unix()))
+	ch <- prometheus.MustNewConstMetric(m.expiry, prometheus.GaugeValue, time.Until(notAfter).Seconds())
+	ch <- prometheus.MustNewConstMetric(m.info, prometheus.GaugeValue, 1,
+		DistinguishedName(m.leaf.Subject), DistinguishedName(m.leaf.Issuer), m.cred.Source)
+}
+
+// helper function to get modification times of given files
+func fileStamps(files []string) map[string]time.Time {
+	stamps := make(map[string]time.Time)
+	for _, fname := range files {
+		if fi, err := os.Stat(fname); err == nil {
+			stamps[fname] = fi.ModTime()
+		}
+	}
+	return stamps
+}
+
+// helper function to check if credential files were changed
+func (m *Manager) changed() bool {
+	if m.stamps == nil {
+		// credential was not loaded yet, try again
+		return true
+	}
+	stamps := fileStamps(m.cred.Files())
+	if len(stamps) != len(m.stamps) {
+		return true
+	}
+	for fname, mtime := range stamps {
+		if !mtime.Equal(m.stamps[fname]) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to load credential and rebuild HTTP transport
+func (m *Manager) reload() {
+	cred, err := ResolveCredential(m.opts.ProxyFile)
+	var stamps map[string]time.Time
+	var certs []tls.Certificate
+	if err == nil {
+		// take file stamps before loading, this way we'll pick up
+		// files which are modified while we read them
+		stamps = fileStamps(cred.Files())
+		certs, err = cred.Certificates()
+	}
+	if err != nil {
+		// keep existing transport and report error only once
+		if err.Error() != m.lastErr {
+			log.Println("unable to get TLS certificate: ", err.Error())
+			m.lastErr = err.Error()
+		}
+		m.stamps = nil
+		return
+	}
+	old := m.transport
+	m.transport = newTransport(m.opts, certs, m.roots)
+	old.CloseIdleConnections()
+	m.cred = cred
+	m.stamps = stamps
+	m.lastErr = ""
+
+	expire := "unknown"
+	m.leaf = nil
+	if leaf, err := leafCertificate(certs); err == nil {
+		m.leaf = leaf
+		expire = leaf.NotAfter.String()
+	}
+	if m.loaded {
+		m.reloads.Inc()
+		log.Printf("reload X509 credential %s, new expiry %s", cred, expire)
+	} else {
+		log.Printf("use X509 credential %s, expiry %s", cred, expire)
+	}
+	m.loaded = true
+}
@@ -0,0 +1,218 @@
+package auth
+
+// Bearer token (OAuth2 / SciToken / IAM) support for cmsweb exporters.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenOptions defines how bearer token should be obtained
+type TokenOptions struct {
+	TokenFile        string   // file with the token, it is re-read when it changes
+	TokenURL         string   // token endpoint of client credentials flow
+	ClientID         string   // client id of client credentials flow
+	ClientSecretFile string   // file with client secret of client credentials flow
+	Scope            string   // space separated list of requested scopes
+	Audience         string   // requested token audience
+	Hosts            []string // hosts which receive the token, it is sent only over HTTPS
+}
+
+// Enabled checks if token authentication is configured
+func (o TokenOptions) Enabled() bool {
+	return o.TokenFile != "" || o.TokenURL != ""
+}
+
+// Allowed checks if token can be sent with given request. The token is sent
+// only over HTTPS to configured hosts and it is never forwarded on redirects
+// to other hosts, e.g. to targets of probe endpoint or hosts chosen by
+// redirecting server.
+func (o TokenOptions) Allowed(req *http.Request) bool {
+	if req.URL.Scheme != "https" {
+		return false
+	}
+	host := req.URL.Hostname()
+	// requests of redirects refer to response which caused them
+	for r := req.Response; r != nil && r.Request != nil; r = r.Request.Response {
+		if !strings.EqualFold(r.Request.URL.Hostname(), host) {
+			return false
+		}
+	}
+	for _, h := range o.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenRecord represents response of token endpoint
+type tokenRecord struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// tokenSource provides bearer token for HTTP requests
+type tokenSource struct {
+	opts     TokenOptions
+	client   *http.Client  // HTTP client to talk to token endpoint
+	fetching chan struct{} // allows single request to token endpoint at a time
+	mutex    sync.Mutex
+	token    string
+	mtime    time.Time // modification time of token file
+	expire   time.Time // expiration time of token obtained from token endpoint
+	renew    time.Time // time to renew token obtained from token endpoint
+}
+
+// helper function to create token source with given options
+func newTokenSource(opts TokenOptions, client *http.Client) *tokenSource {
+	return &tokenSource{opts: opts, client: client, fetching: make(chan struct{}, 1)}
+}
+
+// Token returns current token, it is re-read from token file when the file
+// changes or fetched again from token endpoint when it is about to expire,
+// the token endpoint is queried within given context, e.g. of the scrape
+func (t *tokenSource) Token(ctx context.Context) (string, error) {
+	if t.opts.TokenURL != "" {
+		return t.endpointToken(ctx)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	fi, err := os.Stat(t.opts.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to access token file: %v", err)
+	}
+	if t.token == "" || !fi.ModTime().Equal(t.mtime) {
+		data, err := os.ReadFile(t.opts.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read token file: %v", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", t.opts.TokenFile)
+		}
+		if t.token != "" {
+			log.Printf("reload token from %s", t.opts.TokenFile)
+		}
+		t.token = token
+		t.mtime = fi.ModTime()
+	}
+	return t.token, nil
+}
+
+// helper function to return token obtained from token endpoint, whether it
+// should be renewed and whether it is still valid
+func (t *tokenSource) current() (string, bool, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	valid := t.token != "" && now.Before(t.expire)
+	return t.token, !valid || !now.Before(t.renew), valid
+}
+
+// helper function to return token obtained from token endpoint, only one
+// request talks to the endpoint at a time and the lock is not held meanwhile,
+// so hanging endpoint does not block requests which still can use current
+// token
+func (t *tokenSource) endpointToken(ctx context.Context) (string, error) {
+	token, renew, valid := t.current()
+	if !renew {
+		return token, nil
+	}
+	select {
+	case t.fetching <- struct{}{}:
+	default:
+		// token is renewed by another request, use current one meanwhile
+		if valid {
+			return token, nil
+		}
+		select {
+		case t.fetching <- struct{}{}:
+		case <-ctx.Done():
+			return "", fmt.Errorf("unable to fetch token: %v", ctx.Err())
+		}
+	}
+	defer func() { <-t.fetching }()
+	// token may be renewed by another request while we waited
+	if token, renew, _ := t.current(); !renew {
+		return token, nil
+	}
+	token, expire, err := t.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	// renew token a minute before it expires, short-lived tokens are renewed
+	// in the middle of their lifetime
+	margin := time.Minute
+	if half := time.Until(expire) / 2; half < margin {
+		margin = half
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.token, t.expire, t.renew = token, expire, expire.Add(-margin)
+	return token, nil
+}
+
+// helper function to fetch token and its expiration time via client
+// credentials flow
+func (t *tokenSource) fetch(ctx context.Context) (string, time.Time, error) {
+	var expire time.Time
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", t.opts.ClientID)
+	if t.opts.ClientSecretFile != "" {
+		secret, err := os.ReadFile(t.opts.ClientSecretFile)
+		if err != nil {
+			return "", expire, fmt.Errorf("unable to read client secret: %v", err)
+		}
+		form.Set("client_secret", strings.TrimSpace(string(secret)))
+	}
+	if t.opts.Scope != "" {
+		form.Set("scope", t.opts.Scope)
+	}
+	if t.opts.Audience != "" {
+		form.Set("audience", t.opts.Audience)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.opts.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", expire, fmt.Errorf("unable to create token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", expire, fmt.Errorf("unable to fetch token: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", expire, fmt.Errorf("unable to read token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", expire, fmt.Errorf("token endpoint status %s: %s", resp.Status, data)
+	}
+	var rec tokenRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return "", expire, fmt.Errorf("unable to parse token response: %v", err)
+	}
+	if rec.AccessToken == "" {
+		return "", expire, errors.New("token endpoint did not return access token")
+	}
+	if rec.ExpiresIn <= 0 {
+		// token endpoint did not tell us token lifetime, renew it periodically
+		rec.ExpiresIn = 300
+	}
+	expire = time.Now().Add(time.Duration(rec.ExpiresIn) * time.Second)
+	log.Printf("obtained token from %s, expires %s", t.opts.TokenURL, expire)
+	return rec.AccessToken, expire, nil
+}
@@ -0,0 +1,137 @@
+package auth
+
+// Shared X509 credential handling for cmsweb exporters.
+//
+// Credentials are resolved in the following order:
+//   - explicit proxy file given to the exporter (-proxyfile option)
+//   - X509_USER_PROXY environment variable
+//   - X509_USER_CERT and X509_USER_KEY environment variables
+//   - /tmp/x509up_u$UID proxy file of the current user
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/vkuznet/x509proxy"
+)
+
+// ErrNoCredentials is returned when neither proxy nor user certificates are found
+var ErrNoCredentials = errors.New("neither proxy or user certs are found, please setup X509 environment variables")
+
+// Credential represents X509 credential used by the exporter
+type Credential struct {
+	Proxy  string // proxy file name
+	Cert   string // user certificate file name
+	Key    string // user key file name
+	Source string // explains why this credential was chosen
+}
+
+// String returns human readable representation of the credential
+func (c Credential) String() string {
+	if c.Proxy != "" {
+		return fmt.Sprintf("proxy=%s (%s)", c.Proxy, c.Source)
+	}
+	return fmt.Sprintf("cert=%s key=%s (%s)", c.Cert, c.Key, c.Source)
+}
+
+// Files returns list of files the credential is loaded from
+func (c Credential) Files() []string {
+	if c.Proxy != "" {
+		return []string{c.Proxy}
+	}
+	return []string{c.Cert, c.Key}
+}
+
+// Certificates loads TLS certificates of the credential
+func (c Credential) Certificates() ([]tls.Certificate, error) {
+	if c.Proxy != "" {
+		// use local implementation of LoadX409KeyPair instead of tls one
+		x509cert, err := x509proxy.LoadX509Proxy(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse X509 proxy %s: %v", c.Proxy, err)
+		}
+		return []tls.Certificate{x509cert}, nil
+	}
+	x509cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse user X509 certificate: %v", err)
+	}
+	return []tls.Certificate{x509cert}, nil
+}
+
+// helper function to check that given file exists
+func fileExists(fname string) bool {
+	if fname == "" {
+		return false
+	}
+	_, err := os.Stat(fname)
+	return err == nil
+}
+
+// ResolveCredential finds X509 credential to use, the proxyfile (if provided)
+// takes precedence over environment settings
+func ResolveCredential(proxyfile string) (Credential, error) {
+	if proxyfile != "" {
+		if fileExists(proxyfile) {
+			return Credential{Proxy: proxyfile, Source: "proxyfile option"}, nil
+		}
+		return Credential{}, fmt.Errorf("proxy file %s does not exist", proxyfile)
+	}
+	if uproxy := os.Getenv("X509_USER_PROXY"); uproxy != "" {
+		if fileExists(uproxy) {
+			return Credential{Proxy: uproxy, Source: "X509_USER_PROXY environment"}, nil
+		}
+		return Credential{}, fmt.Errorf("proxy file %s set by X509_USER_PROXY does not exist", uproxy)
+	}
+	ucert := os.Getenv("X509_USER_CERT")
+	uckey := os.Getenv("X509_USER_KEY")
+	if ucert != "" || uckey != "" {
+		if ucert == "" || uckey == "" {
+			return Credential{}, errors.New("both X509_USER_CERT and X509_USER_KEY should be set")
+		}
+		return Credential{Cert: ucert, Key: uckey, Source: "X509_USER_CERT/X509_USER_KEY environment"}, nil
+	}
+	// check if /tmp/x509up_u$UID exists
+	if u, err := user.Current(); err == nil {
+		fname := fmt.Sprintf("/tmp/x509up_u%s", u.Uid)
+		if fileExists(fname) {
+			return Credential{Proxy: fname, Source: "default proxy location"}, nil
+		}
+	}
+	return Credential{}, ErrNoCredentials
+}
+
+// short names of common X509 name attributes
+var attributeNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "street",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.17":                   "postalCode",
+	"0.9.2342.19200300.100.1.1":  "UID",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+}
+
+// DistinguishedName returns Distinguished Name (DN) of given X509 name in
+// OpenSSL format, e.g. /DC=ch/DC=cern/OU=Organic Units/OU=Users/CN=user
+func DistinguishedName(name pkix.Name) string {
+	var parts []string
+	for _, attr := range name.Names {
+		key, ok := attributeNames[attr.Type.String()]
+		if !ok {
+			key = attr.Type.String()
+		}
+		parts = append(parts, fmt.Sprintf("/%s=%v", key, attr.Value))
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,173 @@
+package cache
+
+// Background polling of exporter collectors with cached scrape results.
+//
+// In polling mode the wrapped collector is called on its own interval in a
+// background goroutine, its metrics are cached along with the poll timestamp
+// and Prometheus scrapes are served from the cache. This way several
+// Prometheus replicas scraping the same exporter do not multiply load on
+// cmsweb services.
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector polls wrapped collector in background and serves cached metrics
+type Collector struct {
+	collector prometheus.Collector
+	interval  time.Duration
+	mutex     sync.RWMutex
+	metrics   []prometheus.Metric // metrics collected by last poll
+	timestamp time.Time           // time of last poll
+	ctx       context.Context     // context of polls, canceled to stop polling
+	cancel    context.CancelFunc
+
+	polls    prometheus.Counter
+	duration prometheus.Gauge
+	age      *prometheus.Desc
+	stale    *prometheus.Desc
+	lastPoll *prometheus.Desc
+}
+
+// Wrap returns collector which polls given collector every interval, if
+// interval is not positive the collector is returned as is and it will be
+// called synchronously on every scrape
+func Wrap(namespace string, collector prometheus.Collector, interval time.Duration) prometheus.Collector {
+	if interval <= 0 {
+		return collector
+	}
+	c := NewCollector(namespace, collector, interval)
+	go c.Run()
+	return c
+}
+
+// NewCollector creates new caching collector, its Run method should be
+// called to start polling
+func NewCollector(namespace string, collector prometheus.Collector, interval time.Duration) *Collector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Collector{
+		collector: collector,
+		interval:  interval,
+		ctx:       ctx,
+		cancel:    cancel,
+		polls: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_polls_total",
+			Help:      "Number of background polls of the source",
+		}),
+		duration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cache_poll_duration_seconds",
+			Help:      "Duration of last background poll of the source",
+		}),
+		age: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "cache_age_seconds"),
+			"Age of cached scrape result",
+			nil,
+			nil),
+		stale: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "cache_stale"),
+			"Whether cached scrape result is older than two poll intervals",
+			nil,
+			nil),
+		lastPoll: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "cache_last_poll_timestamp_seconds"),
+			"Timestamp of last background poll of the source",
+			nil,
+			nil),
+	}
+}
+
+// Run polls wrapped collector until Stop is called
+func (c *Collector) Run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.Poll()
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops background polling and cancels poll in progress, e.g. when
+// collector is replaced on configuration reload
+func (c *Collector) Stop() {
+	c.cancel()
+}
+
+// Poll collects metrics of wrapped collector and stores them in cache, poll
+// is canceled if it takes longer than poll interval
+func (c *Collector) Poll() {
+	ctx, cancel := context.WithTimeout(c.ctx, c.interval)
+	defer cancel()
+	start := time.Now()
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var metrics []prometheus.Metric
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+	scrape.Collect(ctx, c.collector, ch)
+	close(ch)
+	<-done
+	elapsed := time.Since(start)
+	if elapsed > c.interval {
+		log.Printf("poll took %v which is longer than poll interval %v", elapsed, c.interval)
+	}
+
+	c.mutex.Lock()
+	c.metrics = metrics
+	c.timestamp = start
+	c.mutex.Unlock()
+	c.polls.Inc()
+	c.duration.Set(elapsed.Seconds())
+}
+
+// Describe implements prometheus.Collector interface
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+	c.polls.Describe(ch)
+	c.duration.Describe(ch)
+	ch <- c.age
+	ch <- c.stale
+	ch <- c.lastPoll
+}
+
+// Collect implements prometheus.Collector interface, it serves metrics from
+// the cache without calling wrapped collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	metrics := c.metrics
+	timestamp := c.timestamp
+	c.mutex.RUnlock()
+
+	c.polls.Collect(ch)
+	if timestamp.IsZero() {
+		// first poll is not finished yet
+		return
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+	age := time.Since(timestamp)
+	var stale float64
+	if age > 2*c.interval {
+		stale = 1
+	}
+	c.duration.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(c.age, prometheus.GaugeValue, age.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.GaugeValue, stale)
+	ch <- prometheus.MustNewConstMetric(c.lastPoll, prometheus.GaugeValue, float64(timestamp.Unix()))
+}
@@ -0,0 +1,59 @@
+package main
+
+// cmsweb-exporter runs cmsweb collectors either individually as subcommands,
+// e.g. cmsweb-exporter das2go -uri http://localhost:8217/das/status, or
+// several of them within single process via configuration file, e.g.
+// cmsweb-exporter -config config.yaml
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dmwm/cmsweb-exporters/collectors/cpy"
+	"github.com/dmwm/cmsweb-exporters/collectors/das2go"
+	"github.com/dmwm/cmsweb-exporters/collectors/eos"
+	"github.com/dmwm/cmsweb-exporters/collectors/httpprobe"
+	"github.com/dmwm/cmsweb-exporters/collectors/process"
+	"github.com/dmwm/cmsweb-exporters/collectors/reqmgr"
+	"github.com/dmwm/cmsweb-exporters/collectors/wmcore"
+	"github.com/dmwm/cmsweb-exporters/exporter"
+	"github.com/dmwm/cmsweb-exporters/ping"
+)
+
+// list of available collectors
+var collectors = []exporter.Collector{
+	cpy.Collector,
+	das2go.Collector,
+	eos.Collector,
+	httpprobe.Collector,
+	process.Collector,
+	reqmgr.Collector,
+	wmcore.Collector,
+}
+
+// main function
+func main() {
+	name := "cmsweb-exporter"
+	args := os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		cmd := args[0]
+		if cmd == "ping" {
+			ping.Main(name+" ping", args[1:])
+			return
+		}
+		for _, c := range collectors {
+			if c.Name == cmd {
+				if err := exporter.Run(c, fmt.Sprintf("%s %s", name, cmd), args[1:]); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		}
+		fmt.Fprintf(os.Stderr, "unknown collector %q, run %s -help to see available collectors\n", cmd, name)
+		os.Exit(2)
+	}
+	if err := exporter.RunConfig(name, args, collectors); err != nil {
+		log.Fatal(err)
+	}
+}
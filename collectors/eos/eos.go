@@ -0,0 +1,182 @@
+package eos
+
+// Author: Valentin Kuznetsov <vkuznet [AT] gmail {DOT} com>
+// Example of cmsweb data-service exporter for prometheus.io
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/exporter"
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector describes eos collector
+var Collector = exporter.Collector{
+	Name:          "eos",
+	Description:   "EOS path access exporter",
+	AddressFlag:   "port",
+	Address:       ":18000",
+	NamespaceFlag: "namespace",
+	Auth:          false,
+	Flags: func(fs *flag.FlagSet) exporter.Config {
+		c := &config{}
+		fs.StringVar(&c.uri, "uri", "", "URI of server status page we're going to scrape")
+		fs.StringVar(&c.proxyfile, "proxyfile", "", "proxy file name")
+		fs.StringVar(&c.eosPath, "eosPath", "", "EOS path to check")
+		fs.StringVar(&c.namespace, "namespace", "eos", "EOS namespace name")
+		return c
+	},
+}
+
+// config represents configuration of eos collector
+type config struct {
+	uri       string
+	namespace string
+	eosPath   string
+	proxyfile string
+}
+
+// Namespace implements exporter.Config interface
+func (c *config) Namespace() string {
+	return c.namespace
+}
+
+// Target implements exporter.TargetConfig interface
+func (c *config) Target() string {
+	return c.eosPath
+}
+
+// NewCollector implements exporter.Config interface
+func (c *config) NewCollector(env *exporter.Env) (prometheus.Collector, error) {
+	return NewExporter(c.uri, c.namespace, c.eosPath, env), nil
+}
+
+type Exporter struct {
+	URI           string
+	mutex         sync.Mutex
+	eosPath       string
+	verbose       bool
+	pending       chan int // result of access check which is still in progress
+	scrapeMetrics *scrape.Metrics
+	status        *prometheus.Desc
+}
+
+const (
+	OkEOS = iota
+	NoAccessToEOS
+	FailedToWriteTempfile
+	FailedToCloseTempfile
+)
+
+// helper function to check eos path and return error code
+func eosAccess(path string, verbose bool) int {
+	_, err := os.Stat(path)
+	if err != nil {
+		if verbose {
+			log.Println(err)
+		}
+		return NoAccessToEOS
+	}
+
+	// create temp file in our path
+	tmpFile, err := ioutil.TempFile(path, "tmp-")
+	defer os.Remove(tmpFile.Name())
+
+	// Example writing to the file
+	text := []byte("This is a test")
+	if _, err = tmpFile.Write(text); err != nil {
+		if verbose {
+			log.Println("Failed to write to temporary file", err)
+		}
+		return FailedToWriteTempfile
+	}
+
+	// Close the file
+	if err := tmpFile.Close(); err != nil {
+		if verbose {
+			log.Println(err)
+		}
+		return FailedToCloseTempfile
+	}
+	return OkEOS
+}
+
+func NewExporter(uri, namespace, eosPath string, env *exporter.Env) *Exporter {
+	return &Exporter{
+		URI:           uri,
+		eosPath:       eosPath,
+		verbose:       env.Verbose,
+		scrapeMetrics: scrape.NewMetrics(namespace),
+		status: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "status"),
+			fmt.Sprintf("Current status of %s", uri),
+			nil,
+			nil),
+	}
+}
+
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.scrapeMetrics.Describe(ch)
+	ch <- e.status
+}
+
+// Collect performs metrics collectio of exporter attributes
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext performs metrics collection within context of the scrape
+func (e *Exporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	e.mutex.Lock() // To protect metrics from concurrent collects.
+	defer e.mutex.Unlock()
+	start := time.Now()
+	err := e.collect(ctx, ch)
+	if err != nil {
+		log.Printf("Error scraping: %s", err)
+	}
+	e.scrapeMetrics.Collect(ch, start, err)
+}
+
+// LastScrape returns status of last scrape of the source
+func (e *Exporter) LastScrape() scrape.Status {
+	return e.scrapeMetrics.Last()
+}
+
+// helper function which collects exporter attributes
+func (e *Exporter) collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	// here is an example how we may collect server stats
+	// we'll make an HTTP call to server URI which will return
+	// status as a JSON document, then we'll assign metrics using JSON values
+
+	// query EOS path, file system calls can't be interrupted therefore we
+	// stop waiting for them when scrape is canceled, the next scrape waits
+	// for the same check to not pile up checks of hanging mount
+	if e.pending == nil {
+		done := make(chan int, 1)
+		go func() {
+			done <- eosAccess(e.eosPath, e.verbose)
+		}()
+		e.pending = done
+	}
+	var ecode int
+	select {
+	case ecode = <-e.pending:
+		e.pending = nil
+	case <-ctx.Done():
+		return scrape.Errorf(scrape.ReasonOther, "access to EOS path %s is not finished: %v", e.eosPath, ctx.Err())
+	}
+
+	ch <- prometheus.MustNewConstMetric(e.status, prometheus.CounterValue, float64(ecode))
+	if ecode != OkEOS {
+		return scrape.Errorf(scrape.ReasonOther, "unable to access EOS path %s, error code %d", e.eosPath, ecode)
+	}
+	return nil
+}
@@ -0,0 +1,933 @@
+package httpprobe
+
+// Author: Valentin Kuznetsov <vkuznet [AT] gmail {DOT} com>
+// HTTP probe of cmsweb services for prometheus.io
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/auth"
+	"github.com/dmwm/cmsweb-exporters/exporter"
+	"github.com/dmwm/cmsweb-exporters/jsonpath"
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Collector describes http collector
+var Collector = exporter.Collector{
+	Name:          "http",
+	Description:   "HTTP probe of cmsweb services",
+	AddressFlag:   "port",
+	Address:       ":18000",
+	NamespaceFlag: "namespace",
+	TimeoutFlag:   "connectionTimeout",
+	Auth:          true,
+	Flags: func(fs *flag.FlagSet) exporter.Config {
+		c := &config{headers: make(headerFlags)}
+		fs.StringVar(&c.uri, "uri", "", "URI of server status page we're going to scrape")
+		fs.StringVar(&c.probeEndpoint, "probeEndpoint", "/probe", "Path under which to probe arbitrary targets.")
+		fs.StringVar(&c.modulesFile, "modules", "", "JSON file with probe modules")
+		fs.StringVar(&c.rulesFile, "rules", "", "JSON file with rules to extract metrics from JSON responses")
+		fs.StringVar(&c.agent, "agent", "", "User-agent to use")
+		fs.StringVar(&c.namespace, "namespace", "http", "namespace for prometheus metrics")
+		fs.StringVar(&c.contentType, "contentType", "", "ContentType to use for HTTP request")
+		fs.StringVar(&c.method, "method", "GET", "HTTP method to use")
+		fs.StringVar(&c.bodyFile, "bodyFile", "", "file with HTTP request body")
+		fs.Var(c.headers, "header", "HTTP header to send in 'Key: Value' form, can be repeated")
+		fs.BoolVar(&c.followRedirects, "followRedirects", true, "follow HTTP redirects")
+		fs.IntVar(&c.connectionTimeout, "connectionTimeout", 3, "connection timeout for HTTP request")
+		fs.IntVar(&c.renewClientInterval, "renewClientInterval", 600, "deprecated, http client is renewed automatically when proxy file changes. If proxy is not needed, please provide 0 or negative integer")
+		return c
+	},
+}
+
+// config represents configuration of http collector
+type config struct {
+	uri                 string
+	probeEndpoint       string
+	modulesFile         string
+	rulesFile           string
+	agent               string
+	namespace           string
+	contentType         string
+	method              string
+	bodyFile            string
+	headers             headerFlags
+	followRedirects     bool
+	connectionTimeout   int
+	renewClientInterval int
+
+	client       *http.Client // client with credentials
+	publicClient *http.Client // client without credentials
+	verbose      bool
+	modules      map[string]Module
+	rules        []*Rule
+}
+
+// Namespace implements exporter.Config interface
+func (c *config) Namespace() string {
+	return c.namespace
+}
+
+// AuthOptions implements exporter.AuthConfig interface
+func (c *config) AuthOptions(opts *auth.Options) {
+	// No need to use proxy auth
+	opts.NoCerts = c.renewClientInterval <= 0
+	opts.Timeout = time.Duration(c.connectionTimeout) * time.Second
+	opts.DisableKeepAlives = true
+}
+
+// Target implements exporter.TargetConfig interface
+func (c *config) Target() string {
+	if c.uri == "" {
+		return fmt.Sprintf("targets of %s endpoint", c.probeEndpoint)
+	}
+	return c.uri
+}
+
+// NewCollector implements exporter.Config interface, the -uri target is
+// probed on every scrape of metrics endpoint, any other target can be probed
+// via probe endpoint
+func (c *config) NewCollector(env *exporter.Env) (prometheus.Collector, error) {
+	client := *env.Client
+	client.Timeout = time.Duration(c.connectionTimeout) * time.Second
+	c.client = &client
+	public := *env.PublicClient
+	public.Timeout = client.Timeout
+	c.publicClient = &public
+	c.verbose = env.Verbose
+	modules, err := c.loadModules()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load probe modules: %v", err)
+	}
+	c.modules = modules
+	rules, err := loadRules(c.rulesFile, c.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load extraction rules: %v", err)
+	}
+	c.rules = rules
+	// metrics of the rules should not clash with metrics of the exporter or
+	// with each other, otherwise every probe fails to register its exporter
+	e := NewExporter(c.uri, c.modules["default"], c)
+	if err := prometheus.NewRegistry().Register(e); err != nil {
+		return nil, fmt.Errorf("invalid extraction rules: %v", err)
+	}
+	env.Mux.HandleFunc(c.probeEndpoint, c.probeHandler)
+	if c.uri == "" {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// Module represents probe module configuration, i.e. how we probe the target
+type Module struct {
+	Method         string            `json:"method"`           // HTTP method to use, default GET
+	Headers        map[string]string `json:"headers"`          // HTTP headers to send
+	ContentType    string            `json:"content_type"`     // content type to accept
+	ExpectedStatus []int             `json:"expected_status"`  // expected HTTP status codes, default 200
+	Assertions     []Assertion       `json:"assertions"`       // assertions of response body
+	Body           string            `json:"body"`             // request body
+	BodyFile       string            `json:"body_file"`        // file with request body
+	Redirects      *bool             `json:"follow_redirects"` // follow redirects, default true
+	Credentials    bool              `json:"credentials"`      // send X509 credential and bearer token with probes of arbitrary targets
+
+	body []byte
+}
+
+// helper function to load request body and compile assertions of the module
+func (m *Module) compile() error {
+	m.body = []byte(m.Body)
+	if m.BodyFile != "" {
+		data, err := ioutil.ReadFile(m.BodyFile)
+		if err != nil {
+			return err
+		}
+		m.body = data
+	}
+	for i := range m.Assertions {
+		a := &m.Assertions[i]
+		if a.Name == "" {
+			a.Name = fmt.Sprintf("assertion%d", i)
+		}
+		if err := a.compile(); err != nil {
+			return fmt.Errorf("assertion %s: %v", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// helper function to check if module follows redirects
+func (m Module) followRedirects() bool {
+	return m.Redirects == nil || *m.Redirects
+}
+
+// headerFlags collects HTTP headers provided via multiple -header options
+type headerFlags map[string]string
+
+// String implements flag.Value interface
+func (h headerFlags) String() string {
+	var out []string
+	for k, v := range h {
+		out = append(out, fmt.Sprintf("%s: %s", k, v))
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
+
+// Set implements flag.Value interface
+func (h headerFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("header %q should be in 'Key: Value' form", value)
+	}
+	h[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	return nil
+}
+
+// Assertion represents check of HTTP response body, all provided conditions
+// should be satisfied for assertion to succeed
+type Assertion struct {
+	Name       string      `json:"name"`        // name of assertion used as metric label
+	Regex      string      `json:"regex"`       // regular expression body must match
+	NotRegex   string      `json:"not_regex"`   // regular expression body must not match
+	Path       string      `json:"path"`        // JSONPath expression, e.g. $.result[0].status
+	Equals     interface{} `json:"equals"`      // expected value found at JSON path
+	Contains   string      `json:"contains"`    // substring (or list element) expected at JSON path
+	MinRecords int         `json:"min_records"` // minimum number of records found at JSON path
+
+	regex    *regexp.Regexp
+	notRegex *regexp.Regexp
+	path     *jsonpath.Path
+}
+
+// helper function to compile regular expressions and JSON path of assertion
+func (a *Assertion) compile() error {
+	var err error
+	if a.Regex != "" {
+		if a.regex, err = regexp.Compile(a.Regex); err != nil {
+			return err
+		}
+	}
+	if a.NotRegex != "" {
+		if a.notRegex, err = regexp.Compile(a.NotRegex); err != nil {
+			return err
+		}
+	}
+	if a.Path != "" {
+		if a.path, err = jsonpath.Compile(a.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper function to check if assertion requires JSON body
+func (a *Assertion) needJSON() bool {
+	return a.path != nil || a.Equals != nil || a.Contains != "" || a.MinRecords > 0
+}
+
+// helper function to check assertion against response body, the doc is
+// decoded JSON body or nil if body is not JSON
+func (a *Assertion) check(data []byte, doc interface{}) bool {
+	if a.regex != nil && !a.regex.Match(data) {
+		return false
+	}
+	if a.notRegex != nil && a.notRegex.Match(data) {
+		return false
+	}
+	if !a.needJSON() {
+		return true
+	}
+	if doc == nil {
+		return false
+	}
+	values := []interface{}{doc}
+	if a.path != nil {
+		values = a.path.Get(doc)
+	}
+	if len(values) == 0 {
+		return false
+	}
+	val := values[0]
+	if a.Equals != nil && fmt.Sprintf("%v", val) != fmt.Sprintf("%v", a.Equals) {
+		return false
+	}
+	if a.Contains != "" {
+		found := false
+		if arr, ok := val.([]interface{}); ok {
+			for _, v := range arr {
+				if fmt.Sprintf("%v", v) == a.Contains {
+					found = true
+					break
+				}
+			}
+		} else {
+			found = strings.Contains(fmt.Sprintf("%v", val), a.Contains)
+		}
+		if !found {
+			return false
+		}
+	}
+	if a.MinRecords > 0 {
+		// wildcard path yields records directly, otherwise we expect a list
+		nrec := len(values)
+		if a.path == nil || !a.path.Wildcard() {
+			arr, ok := val.([]interface{})
+			if !ok {
+				return false
+			}
+			nrec = len(arr)
+		}
+		if nrec < a.MinRecords {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function to check if given status code is expected by the module
+func (m Module) expected(code int) bool {
+	if len(m.ExpectedStatus) == 0 {
+		return code == http.StatusOK
+	}
+	for _, c := range m.ExpectedStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to load probe modules from given JSON file, the default
+// module is constructed from command line options unless it is defined in a file
+func (c *config) loadModules() (map[string]Module, error) {
+	modules := make(map[string]Module)
+	if fname := c.modulesFile; fname != "" {
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &modules); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %v", fname, err)
+		}
+	}
+	if _, ok := modules["default"]; !ok {
+		if c.agent != "" {
+			c.headers["User-Agent"] = c.agent
+		}
+		modules["default"] = Module{
+			Method:      c.method,
+			Headers:     c.headers,
+			ContentType: c.contentType,
+			BodyFile:    c.bodyFile,
+			Redirects:   &c.followRedirects,
+		}
+	}
+	for name, m := range modules {
+		if err := m.compile(); err != nil {
+			return nil, fmt.Errorf("module %s: %v", name, err)
+		}
+		modules[name] = m
+	}
+	return modules, nil
+}
+
+// Rule represents extraction of metric from JSON document. The path selects
+// records (use [*] to iterate over arrays), the value and labels are JSONPath
+// expressions relative to each record, e.g.
+// {"name": "requests", "path": "$.services[*]", "value": "$.requests", "labels": {"service": "$.name"}}
+type Rule struct {
+	Name   string            `json:"name"`   // metric name, namespace is added automatically
+	Help   string            `json:"help"`   // metric help
+	Type   string            `json:"type"`   // metric type: gauge (default) or counter
+	Path   string            `json:"path"`   // JSONPath of records
+	Value  string            `json:"value"`  // JSONPath of value within a record, default is record itself
+	Labels map[string]string `json:"labels"` // label names and JSONPath of label values within a record
+
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	path      *jsonpath.Path
+	value     *jsonpath.Path
+	labelKeys []string
+	labels    []*jsonpath.Path
+}
+
+// helper function to load extraction rules from given JSON file
+func loadRules(fname, namespace string) ([]*Rule, error) {
+	var rules []*Rule
+	if fname == "" {
+		return rules, nil
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", fname, err)
+	}
+	for _, r := range rules {
+		if err := r.compile(namespace); err != nil {
+			return nil, fmt.Errorf("rule %s: %v", r.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// helper function to compile JSONPath expressions and metric description of the rule
+func (r *Rule) compile(namespace string) error {
+	var err error
+	if r.Name == "" {
+		return fmt.Errorf("metric name is missing")
+	}
+	switch r.Type {
+	case "", "gauge":
+		r.valueType = prometheus.GaugeValue
+	case "counter":
+		r.valueType = prometheus.CounterValue
+	default:
+		return fmt.Errorf("unsupported metric type %s", r.Type)
+	}
+	path := r.Path
+	if path == "" {
+		path = "$"
+	}
+	if r.path, err = jsonpath.Compile(path); err != nil {
+		return err
+	}
+	value := r.Value
+	if value == "" {
+		value = "$"
+	}
+	if r.value, err = jsonpath.Compile(value); err != nil {
+		return err
+	}
+	r.labelKeys = nil
+	r.labels = nil
+	for key := range r.Labels {
+		r.labelKeys = append(r.labelKeys, key)
+	}
+	sort.Strings(r.labelKeys)
+	for _, key := range r.labelKeys {
+		p, err := jsonpath.Compile(r.Labels[key])
+		if err != nil {
+			return err
+		}
+		r.labels = append(r.labels, p)
+	}
+	help := r.Help
+	if help == "" {
+		help = fmt.Sprintf("Value of %s extracted from JSON response", path)
+	}
+	r.desc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", r.Name),
+		help,
+		r.labelKeys,
+		nil)
+	return nil
+}
+
+// helper function to convert JSON value into metric value
+func metricValue(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case bool:
+		return boolValue(val), true
+	case string:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// helper function to send metrics extracted by the rule from given JSON document
+func (r *Rule) collect(ch chan<- prometheus.Metric, doc interface{}, verbose bool) {
+	seen := make(map[string]bool)
+	for _, rec := range r.path.Get(doc) {
+		values := r.value.Get(rec)
+		if len(values) == 0 {
+			continue
+		}
+		val, ok := metricValue(values[0])
+		if !ok {
+			if verbose {
+				log.Printf("rule %s: unable to convert %v to metric value\n", r.Name, values[0])
+			}
+			continue
+		}
+		var labels []string
+		for _, p := range r.labels {
+			lval := ""
+			if v := p.Get(rec); len(v) > 0 {
+				lval = fmt.Sprintf("%v", v[0])
+			}
+			labels = append(labels, lval)
+		}
+		// prometheus rejects metrics with duplicate label values
+		key := strings.Join(labels, "\xff")
+		if seen[key] {
+			if verbose {
+				log.Printf("rule %s: skip duplicate labels %v\n", r.Name, labels)
+			}
+			continue
+		}
+		seen[key] = true
+		ch <- prometheus.MustNewConstMetric(r.desc, r.valueType, val, labels...)
+	}
+}
+
+type Exporter struct {
+	URI            string
+	Module         Module
+	Rules          []*Rule
+	mutex          sync.Mutex
+	client         *http.Client
+	verbose        bool
+	scrapeMetrics  *scrape.Metrics
+	status         *prometheus.Desc
+	success        *prometheus.Desc
+	duration       *prometheus.Desc
+	responseSize   *prometheus.Desc
+	assertion      *prometheus.Desc
+	tlsNotAfter    *prometheus.Desc
+	tlsChainExpiry *prometheus.Desc
+	tlsHostMatch   *prometheus.Desc
+	tlsInfo        *prometheus.Desc
+	redirects      *prometheus.Desc
+	finalURL       *prometheus.Desc
+}
+
+func NewExporter(uri string, module Module, c *config) *Exporter {
+	namespace := c.namespace
+	return &Exporter{
+		URI:           uri,
+		Module:        module,
+		Rules:         c.rules,
+		client:        c.client,
+		verbose:       c.verbose,
+		scrapeMetrics: scrape.NewMetrics(namespace),
+		status: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "status"),
+			fmt.Sprintf("Current status of %s", uri),
+			nil,
+			nil),
+		success: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "success"),
+			fmt.Sprintf("Whether probe of %s was successful", uri),
+			nil,
+			nil),
+		duration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "duration_seconds"),
+			"Duration of HTTP request by phase: dns, connect, tls, first_byte and total",
+			[]string{"phase"},
+			nil),
+		responseSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "response_size_bytes"),
+			"Size of HTTP response body in bytes",
+			nil,
+			nil),
+		assertion: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "assertion_success"),
+			"Whether assertion of HTTP response body was successful",
+			[]string{"assertion"},
+			nil),
+		tlsNotAfter: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tls_not_after_timestamp_seconds"),
+			"NotAfter timestamp of server certificate",
+			nil,
+			nil),
+		tlsChainExpiry: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tls_chain_not_after_timestamp_seconds"),
+			"Earliest NotAfter timestamp of certificates in server certificate chain",
+			nil,
+			nil),
+		tlsHostMatch: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tls_hostname_match"),
+			"Whether server certificate SANs match target host name",
+			nil,
+			nil),
+		tlsInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tls_info"),
+			"Information about server certificate and negotiated TLS connection",
+			[]string{"version", "cipher", "subject", "issuer"},
+			nil),
+		redirects: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "redirects"),
+			"Number of redirects followed by HTTP request",
+			nil,
+			nil),
+		finalURL: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "final_url_info"),
+			"Final URL of HTTP request after redirects",
+			[]string{"url"},
+			nil),
+	}
+}
+
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.scrapeMetrics.Describe(ch)
+	ch <- e.status
+	ch <- e.success
+	ch <- e.duration
+	ch <- e.responseSize
+	ch <- e.assertion
+	ch <- e.tlsNotAfter
+	ch <- e.tlsChainExpiry
+	ch <- e.tlsHostMatch
+	ch <- e.tlsInfo
+	ch <- e.redirects
+	ch <- e.finalURL
+	for _, r := range e.Rules {
+		ch <- r.desc
+	}
+}
+
+// names of TLS versions
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// helper function to send metrics about server certificate and TLS connection
+func (e *Exporter) collectTLS(ch chan<- prometheus.Metric, state *tls.ConnectionState, host string) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	leaf := state.PeerCertificates[0]
+	// use verified chain if we have it, otherwise certificates sent by server
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	expire := leaf.NotAfter
+	for _, cert := range chain {
+		if cert.NotAfter.Before(expire) {
+			expire = cert.NotAfter
+		}
+	}
+	version, ok := tlsVersions[state.Version]
+	if !ok {
+		version = fmt.Sprintf("0x%04x", state.Version)
+	}
+	match := leaf.VerifyHostname(host) == nil
+	ch <- prometheus.MustNewConstMetric(e.tlsNotAfter, prometheus.GaugeValue, float64(leaf.NotAfter.Unix()))
+	ch <- prometheus.MustNewConstMetric(e.tlsChainExpiry, prometheus.GaugeValue, float64(expire.Unix()))
+	ch <- prometheus.MustNewConstMetric(e.tlsHostMatch, prometheus.GaugeValue, boolValue(match))
+	ch <- prometheus.MustNewConstMetric(e.tlsInfo, prometheus.GaugeValue, 1,
+		version, tls.CipherSuiteName(state.CipherSuite),
+		auth.DistinguishedName(leaf.Subject), auth.DistinguishedName(leaf.Issuer))
+}
+
+// helper function to send metrics extracted by rules from JSON response
+func (e *Exporter) collectRules(ch chan<- prometheus.Metric, data []byte) {
+	if len(e.Rules) == 0 {
+		return
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if e.verbose {
+			log.Printf("unable to decode JSON to extract metrics, url=%s error=%v\n", e.URI, err)
+		}
+		return
+	}
+	for _, r := range e.Rules {
+		r.collect(ch, doc, e.verbose)
+	}
+}
+
+// helper function to send status, success and assertion metrics to prometheus,
+// the data is response body or nil if we did not get it
+func (e *Exporter) collectStatus(ch chan<- prometheus.Metric, status float64, success bool, data []byte) {
+	var doc interface{}
+	for _, a := range e.Module.Assertions {
+		if doc == nil && data != nil && a.needJSON() {
+			if err := json.Unmarshal(data, &doc); err != nil && e.verbose {
+				log.Printf("unable to decode JSON for assertion %s, error=%v\n", a.Name, err)
+			}
+		}
+		ok := data != nil && a.check(data, doc)
+		if !ok {
+			success = false
+			if e.verbose {
+				log.Printf("assertion %s failed, url=%s\n", a.Name, e.URI)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(e.assertion, prometheus.GaugeValue, boolValue(ok), a.Name)
+	}
+	ch <- prometheus.MustNewConstMetric(e.status, prometheus.CounterValue, status)
+	ch <- prometheus.MustNewConstMetric(e.success, prometheus.GaugeValue, boolValue(success))
+}
+
+// timings holds timestamps of HTTP request phases collected via httptrace
+type timings struct {
+	mutex        sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	end          time.Time
+	size         int
+}
+
+// helper function to create httptrace hooks which record request phases
+func (t *timings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(_ httptrace.DNSStartInfo) { t.record(&t.dnsStart) },
+		DNSDone:              func(_ httptrace.DNSDoneInfo) { t.record(&t.dnsDone) },
+		ConnectStart:         func(_, _ string) { t.record(&t.connectStart) },
+		ConnectDone:          func(_, _ string, _ error) { t.record(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.record(&t.tlsStart) },
+		TLSHandshakeDone:     func(_ tls.ConnectionState, _ error) { t.record(&t.tlsDone) },
+		GotFirstResponseByte: func() { t.record(&t.firstByte) },
+	}
+}
+
+// helper function to record current time, httptrace hooks may be called
+// from different goroutines
+func (t *timings) record(ts *time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	*ts = time.Now()
+}
+
+// helper function to get duration between two timestamps, phases which
+// did not happen, e.g. DNS lookup of IP address, have zero duration
+func phase(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start).Seconds()
+}
+
+// helper function to send timing metrics to prometheus
+func (e *Exporter) collectTimings(ch chan<- prometheus.Metric, t *timings) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.end.IsZero() {
+		// request failed before response body was read
+		t.end = time.Now()
+	}
+	phases := map[string]float64{
+		"dns":        phase(t.dnsStart, t.dnsDone),
+		"connect":    phase(t.connectStart, t.connectDone),
+		"tls":        phase(t.tlsStart, t.tlsDone),
+		"first_byte": phase(t.start, t.firstByte),
+		"total":      phase(t.start, t.end),
+	}
+	for name, val := range phases {
+		ch <- prometheus.MustNewConstMetric(e.duration, prometheus.GaugeValue, val, name)
+	}
+	ch <- prometheus.MustNewConstMetric(e.responseSize, prometheus.GaugeValue, float64(t.size))
+}
+
+// Collect performs metrics collectio of exporter attributes
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext performs metrics collection within context of the scrape
+func (e *Exporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	e.mutex.Lock() // To protect metrics from concurrent collects.
+	defer e.mutex.Unlock()
+	start := time.Now()
+	err := e.collect(ctx, ch)
+	if err != nil {
+		log.Printf("Error scraping: %s", err)
+	}
+	e.scrapeMetrics.Collect(ch, start, err)
+}
+
+// LastScrape returns status of last scrape of the source
+func (e *Exporter) LastScrape() scrape.Status {
+	return e.scrapeMetrics.Last()
+}
+
+// helper function which collects exporter attributes
+func (e *Exporter) collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	// here is an example how we may collect server stats
+	// we'll make an HTTP call to server URI which will return
+	// status as a JSON document, then we'll assign metrics using JSON values
+	method := e.Module.Method
+	if method == "" {
+		method = "GET"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.URI, bytes.NewReader(e.Module.body))
+	if err != nil {
+		e.collectStatus(ch, 0, false, nil)
+		return fmt.Errorf("unable to create HTTP request: %v", err)
+	}
+	req.Header.Add("Accept-Encoding", "identity")
+	if e.Module.ContentType != "" {
+		req.Header.Add("Accept", e.Module.ContentType)
+	}
+	for k, v := range e.Module.Headers {
+		req.Header.Set(k, v)
+	}
+
+	/*
+		// Example how to organize termination of function
+		// see: https://blog.golang.org/concurrency-timeouts
+
+		// get http response from the site
+		var resp *http.Response
+		var respError error
+		abort := make(chan struct{})
+		go func(r *http.Request) {
+			resp, respError = httpClient.Do(r)
+			abort <- "ok"
+		}(req)
+
+		// try to get response or timeout after connection timeout interval
+		select {
+		case <-abort:
+			// a read from abort channel has occurred, let's close it
+			close(abort)
+		case <-time.After(time.Duration(*connectionTimeout) * time.Second):
+			// the read from ch has timed out
+			msg := fmt.Sprintf("Timeout after %v (sec)", *connectionTimeout)
+			respError = errors.New(msg)
+			close(abort)
+		}
+	*/
+
+	t := &timings{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace()))
+	t.start = time.Now()
+	defer e.collectTimings(ch, t)
+
+	// follow redirects only if module asks for it and count them
+	var redirects int
+	client := *e.client
+	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if !e.Module.followRedirects() {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		redirects = len(via)
+		return nil
+	}
+	resp, respError := client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	ch <- prometheus.MustNewConstMetric(e.redirects, prometheus.GaugeValue, float64(redirects))
+	if resp != nil && resp.Request != nil {
+		ch <- prometheus.MustNewConstMetric(e.finalURL, prometheus.GaugeValue, 1, resp.Request.URL.String())
+	}
+	if respError != nil {
+		e.collectStatus(ch, 0, false, nil)
+		return fmt.Errorf("unable to make HTTP request to %s: %w", e.URI, respError)
+	}
+
+	// certificate is presented by the host of the final request
+	e.collectTLS(ch, resp.TLS, resp.Request.URL.Hostname())
+
+	val := float64(resp.StatusCode)
+	data, err := ioutil.ReadAll(resp.Body)
+	// total time does not include processing of the response body below
+	t.record(&t.end)
+	t.size = len(data)
+	// Stdout response body if not successful
+	if resp.StatusCode != 200 {
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		e.collectStatus(ch, val, e.Module.expected(resp.StatusCode), data)
+		if e.verbose {
+			log.Printf("HTTP request info, status=%v code=%v data=%s\n", resp.Status, resp.StatusCode, string(data))
+		}
+		if !e.Module.expected(resp.StatusCode) {
+			return scrape.Errorf(scrape.ReasonHTTPStatus, "unexpected status %s of %s", resp.Status, e.URI)
+		}
+		return nil
+	}
+	success := e.Module.expected(resp.StatusCode)
+	e.collectRules(ch, data)
+	if e.Module.ContentType == "application/json" {
+		var rec map[string]interface{}
+		err = json.Unmarshal(data, &rec)
+		if err != nil {
+			// let's try to decode list of records
+			var records []map[string]interface{}
+			err = json.Unmarshal(data, &records)
+			if err != nil {
+				if e.verbose {
+					log.Printf("Fail to unmarshal the data, error=%v data=%s\n", err.Error(), string(data))
+				}
+				e.collectStatus(ch, 0, false, data)
+				return scrape.Errorf(scrape.ReasonDecode, "unable to decode JSON response of %s: %v", e.URI, err)
+			}
+			e.collectStatus(ch, val, success, data)
+			return nil
+		}
+		if e.verbose {
+			log.Println("received data", string(data))
+		}
+	}
+	e.collectStatus(ch, val, success, data)
+	return nil
+}
+
+// helper function to convert boolean into metric value
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// probeHandler probes target provided in HTTP request with given module,
+// e.g. /probe?target=https://cmsweb.cern.ch/dbs/prod/global/DBSReader/status&module=json
+func (c *config) probeHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("module")
+	if name == "" {
+		name = "default"
+	}
+	module, ok := c.modules[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", name), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := scrape.Context(r)
+	defer cancel()
+	// targets are chosen by callers of probe endpoint, therefore credentials
+	// of the exporter are sent to them only if module asks for it
+	e := NewExporter(target, module, c)
+	if !module.Credentials {
+		e.client = c.publicClient
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(scrape.WithContext(ctx, e))
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,127 @@
+package httpprobe
+
+// Tests of response body assertions of http probe.
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// test response body used by assertion tests
+const testBody = `{
+	"status": "ok",
+	"code": 200,
+	"enabled": true,
+	"datasets": [
+		{"dataset": "/a/b/RAW", "dataset_access_type": "VALID"},
+		{"dataset": "/c/d/AOD", "dataset_access_type": "INVALID"}
+	],
+	"single": [{"dataset": "/e/f/RAW"}],
+	"nested": [[1, 2, 3]],
+	"tags": ["prod", "global"],
+	"empty": []
+}`
+
+// TestAssertionCheck tests assertions against JSON response body
+func TestAssertionCheck(t *testing.T) {
+	data := []byte(testBody)
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unable to decode test body: %v", err)
+	}
+	tests := []struct {
+		name string
+		a    Assertion
+		want bool
+	}{
+		{"empty assertion", Assertion{}, true},
+		// regular expressions
+		{"regex match", Assertion{Regex: `"status":\s*"ok"`}, true},
+		{"regex no match", Assertion{Regex: `(?i)error`}, false},
+		{"not_regex match", Assertion{NotRegex: `INVALID`}, false},
+		{"not_regex no match", Assertion{NotRegex: `(?i)error`}, true},
+		// equals
+		{"equals string", Assertion{Path: "$.status", Equals: "ok"}, true},
+		{"equals wrong string", Assertion{Path: "$.status", Equals: "failed"}, false},
+		{"equals number", Assertion{Path: "$.code", Equals: 200}, true},
+		{"equals decoded number", Assertion{Path: "$.code", Equals: 200.0}, true},
+		{"equals bool", Assertion{Path: "$.enabled", Equals: true}, true},
+		{"equals nested", Assertion{Path: "$.datasets[0].dataset_access_type", Equals: "VALID"}, true},
+		{"equals first of wildcard", Assertion{Path: "$.datasets[*].dataset_access_type", Equals: "VALID"}, true},
+		{"equals missing path", Assertion{Path: "$.missing", Equals: "ok"}, false},
+		// contains
+		{"contains substring", Assertion{Path: "$.datasets[1].dataset", Contains: "AOD"}, true},
+		{"contains no substring", Assertion{Path: "$.datasets[1].dataset", Contains: "RAW"}, false},
+		{"contains list element", Assertion{Path: "$.tags", Contains: "global"}, true},
+		{"contains no list element", Assertion{Path: "$.tags", Contains: "glob"}, false},
+		// min_records of a list
+		{"min_records list", Assertion{Path: "$.datasets", MinRecords: 2}, true},
+		{"min_records short list", Assertion{Path: "$.datasets", MinRecords: 3}, false},
+		{"min_records single element list", Assertion{Path: "$.single", MinRecords: 1}, true},
+		{"min_records empty list", Assertion{Path: "$.empty", MinRecords: 1}, false},
+		{"min_records not a list", Assertion{Path: "$.status", MinRecords: 1}, false},
+		{"min_records root", Assertion{MinRecords: 1}, false},
+		{"min_records missing path", Assertion{Path: "$.missing", MinRecords: 1}, false},
+		// min_records of records matched by wildcard
+		{"min_records wildcard", Assertion{Path: "$.datasets[*]", MinRecords: 2}, true},
+		{"min_records short wildcard", Assertion{Path: "$.datasets[*]", MinRecords: 3}, false},
+		{"min_records wildcard single record", Assertion{Path: "$.single[*]", MinRecords: 1}, true},
+		{"min_records wildcard single list record", Assertion{Path: "$.nested[*]", MinRecords: 2}, false},
+		{"min_records wildcard of values", Assertion{Path: "$.datasets[*].dataset", MinRecords: 2}, true},
+		{"min_records wildcard no records", Assertion{Path: "$.empty[*]", MinRecords: 1}, false},
+		// combination of checks
+		{"all checks", Assertion{NotRegex: `(?i)error`, Path: "$.tags", Contains: "prod", MinRecords: 2}, true},
+		{"failed regex of combination", Assertion{Regex: `(?i)error`, Path: "$.tags", MinRecords: 1}, false},
+	}
+	for _, tt := range tests {
+		a := tt.a
+		if err := a.compile(); err != nil {
+			t.Errorf("%s: unable to compile assertion: %v", tt.name, err)
+			continue
+		}
+		if got := a.check(data, doc); got != tt.want {
+			t.Errorf("%s: check() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestAssertionCheckNonJSON tests assertions against body which is not JSON
+func TestAssertionCheckNonJSON(t *testing.T) {
+	data := []byte("<html>Service is up</html>")
+	tests := []struct {
+		name string
+		a    Assertion
+		want bool
+	}{
+		{"regex", Assertion{Regex: "is up"}, true},
+		{"not_regex", Assertion{NotRegex: "is up"}, false},
+		{"path", Assertion{Path: "$.status"}, false},
+		{"equals", Assertion{Equals: "ok"}, false},
+		{"min_records", Assertion{MinRecords: 1}, false},
+	}
+	for _, tt := range tests {
+		a := tt.a
+		if err := a.compile(); err != nil {
+			t.Errorf("%s: unable to compile assertion: %v", tt.name, err)
+			continue
+		}
+		if got := a.check(data, nil); got != tt.want {
+			t.Errorf("%s: check() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestAssertionCompile tests rejection of invalid assertions
+func TestAssertionCompile(t *testing.T) {
+	tests := []Assertion{
+		{Regex: "("},
+		{NotRegex: "[a-"},
+		{Path: "$.datasets["},
+		{Path: "datasets"},
+	}
+	for _, a := range tests {
+		if err := a.compile(); err == nil {
+			t.Errorf("compile() of %+v expected error", a)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package process
+
+// CPU usage of processes and threads computed from /proc/PID/stat samples.
+
+import (
+	"time"
+
+	"github.com/prometheus/procfs"
+)
+
+// userHZ defines number of clock ticks per second used in /proc/PID/stat
+const userHZ = 100
+
+// cpuKey identifies process (tid is 0) or thread of the process
+type cpuKey struct {
+	pid int
+	tid int
+}
+
+// cpuSample represents CPU time of process or thread at given time
+type cpuSample struct {
+	start uint64    // start time in clock ticks since boot, used to detect reuse of PIDs
+	cpu   float64   // user and system CPU time in seconds
+	time  time.Time // time of the sample
+}
+
+// cpuUsage represents CPU usage of process computed during current scrape
+type cpuUsage struct {
+	start uint64  // start time of the process in clock ticks since boot
+	total float64 // CPU usage of the process in percent
+	max   float64 // highest CPU usage of its threads in percent
+}
+
+// cpuTracker computes CPU usage of processes and threads as delta of their
+// user and system CPU time over wall time between successive scrapes
+type cpuTracker struct {
+	bootTime float64 // boot time of the node in seconds since epoch
+	samples  map[cpuKey]cpuSample
+	seen     map[cpuKey]bool
+	usages   map[int]cpuUsage // usage of processes computed during current scrape
+}
+
+// helper function to create new CPU tracker
+func newCPUTracker() *cpuTracker {
+	return &cpuTracker{
+		samples: make(map[cpuKey]cpuSample),
+		seen:    make(map[cpuKey]bool),
+		usages:  make(map[int]cpuUsage),
+	}
+}
+
+// helper function to return CPU usage in percent of process or thread with
+// given stat, on first sample average usage since start of the process is
+// returned
+func (t *cpuTracker) percent(key cpuKey, stat procfs.ProcStat, now time.Time) float64 {
+	cur := cpuSample{start: stat.Starttime, cpu: stat.CPUTime(), time: now}
+	prev, ok := t.samples[key]
+	t.samples[key] = cur
+	t.seen[key] = true
+	if !ok || prev.start != cur.start {
+		// new process or thread, zero CPU time at its start
+		started := t.startTime(stat)
+		if started == 0 {
+			return 0
+		}
+		prev = cpuSample{time: time.Unix(0, int64(started*float64(time.Second)))}
+	}
+	elapsed := cur.time.Sub(prev.time).Seconds()
+	if elapsed <= 0 || cur.cpu < prev.cpu {
+		return 0
+	}
+	return 100 * (cur.cpu - prev.cpu) / elapsed
+}
+
+// helper function to return boot time of the node, it is read once
+func (t *cpuTracker) boot() float64 {
+	if t.bootTime == 0 {
+		if s, err := procfs.NewStat(); err == nil {
+			t.bootTime = float64(s.BootTime)
+		}
+	}
+	return t.bootTime
+}
+
+// helper function to return start time of process or thread with given
+// stat in seconds since unix epoch, zero if boot time is not available
+func (t *cpuTracker) startTime(stat procfs.ProcStat) float64 {
+	boot := t.boot()
+	if boot == 0 {
+		return 0
+	}
+	return boot + float64(stat.Starttime)/userHZ
+}
+
+// helper function to return CPU usage of given process and highest CPU usage
+// of its threads in percent, usage is computed once per scrape since the same
+// process may belong to several groups
+func (t *cpuTracker) usage(proc procfs.Proc, stat procfs.ProcStat) (float64, float64) {
+	if u, ok := t.usages[proc.PID]; ok && u.start == stat.Starttime {
+		return u.total, u.max
+	}
+	now := time.Now()
+	u := cpuUsage{start: stat.Starttime, total: t.percent(cpuKey{pid: proc.PID}, stat, now)}
+	if threads, err := procfs.AllThreads(proc.PID); err == nil {
+		for _, thread := range threads {
+			tstat, err := thread.Stat()
+			if err != nil {
+				// thread may exit in a meantime
+				continue
+			}
+			if v := t.percent(cpuKey{pid: proc.PID, tid: thread.PID}, tstat, now); v > u.max {
+				u.max = v
+			}
+		}
+	}
+	t.usages[proc.PID] = u
+	return u.total, u.max
+}
+
+// helper function to drop samples of processes and threads which were not
+// seen since previous call, it is called at the end of every scrape
+func (t *cpuTracker) sweep() {
+	t.usages = make(map[int]cpuUsage)
+	for key := range t.samples {
+		if !t.seen[key] {
+			delete(t.samples, key)
+		}
+	}
+	t.seen = make(map[cpuKey]bool)
+}
@@ -0,0 +1,96 @@
+package process
+
+// Named groups of processes monitored by single process exporter.
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// GroupsConfig represents file with groups of processes to monitor, e.g.
+//
+//	groups:
+//	  - name: reqmgr2
+//	    pidfile: /data/srv/state/reqmgr2/pid
+//	    children: true
+//	  - name: crabserver
+//	    cmdline: "crabserver.*config"
+//	    user: _crabserver
+//	  - name: scitoken
+//	    exe: scitoken-proxy
+type GroupsConfig struct {
+	Groups []GroupConfig `yaml:"groups"` // groups of processes
+}
+
+// GroupConfig represents named group of processes, processes are selected
+// in the same way as by command line options of process exporter
+type GroupConfig struct {
+	Name     string `yaml:"name"`     // name of the group, used as value of group label
+	PID      int    `yaml:"pid"`      // fixed PID of the process
+	PIDFile  string `yaml:"pidfile"`  // file with PID or process group id
+	Exe      string `yaml:"exe"`      // executable name of processes
+	Cmdline  string `yaml:"cmdline"`  // regular expression to match command line of processes
+	User     string `yaml:"user"`     // user name or id of process owner
+	Children bool   `yaml:"children"` // aggregate metrics of descendant processes separately
+}
+
+// group represents named group of monitored processes
+type group struct {
+	name     string
+	selector *selector
+	all      bool // aggregate all matching processes, otherwise monitor the one with highest PID
+	children bool // monitor main processes and aggregate their descendants separately
+}
+
+// helper function to return label values of the group metrics
+func (g group) labels() []string {
+	if g.name == "" {
+		return nil
+	}
+	return []string{g.name}
+}
+
+// helper function to load groups of processes from given file, children
+// option enables aggregation of descendant processes in every group
+func loadGroups(fname string, children bool) ([]group, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var cfg GroupsConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", fname, err)
+	}
+	if len(cfg.Groups) == 0 {
+		return nil, fmt.Errorf("%s: no groups are configured", fname)
+	}
+	var groups []group
+	names := make(map[string]bool)
+	for idx, gc := range cfg.Groups {
+		if gc.Name == "" {
+			return nil, fmt.Errorf("%s: group #%d has no name", fname, idx)
+		}
+		if names[gc.Name] {
+			return nil, fmt.Errorf("%s: duplicate group %s", fname, gc.Name)
+		}
+		names[gc.Name] = true
+		sel, err := newSelector(gc.PID, gc.PIDFile, gc.Exe, gc.Cmdline, gc.User)
+		if err != nil {
+			return nil, fmt.Errorf("%s: group %s: %v", fname, gc.Name, err)
+		}
+		groups = append(groups, group{name: gc.Name, selector: sel, all: true, children: children || gc.Children})
+	}
+	return groups, nil
+}
+
+// helper function to return names of given groups
+func groupNames(groups []group) string {
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.name)
+	}
+	return strings.Join(names, ", ")
+}
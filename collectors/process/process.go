@@ -0,0 +1,796 @@
+package process
+
+// Author: Valentin Kuznetsov <vkuznet [AT] gmail {DOT} com>
+// Example of cmsweb data-service exporter for prometheus.io
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/exporter"
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+	psprocess "github.com/shirou/gopsutil/process"
+)
+
+// Collector describes process collector
+var Collector = exporter.Collector{
+	Name:          "process",
+	Description:   "process and node metrics exporter",
+	AddressFlag:   "address",
+	Address:       ":18000",
+	NamespaceFlag: "prefix",
+	Auth:          false,
+	Flags: func(fs *flag.FlagSet) exporter.Config {
+		c := &config{}
+		fs.StringVar(&c.uri, "uri", "", "URI of server status page we're going to scrape")
+		fs.StringVar(&c.namespace, "prefix", "process_exporter", "namespace/prefix to use")
+		fs.IntVar(&c.pid, "pid", 0, "PID of the process we're going to scrape")
+		fs.StringVar(&c.pidfile, "pidfile", "", "file with PID or process group id of the process, e.g. /data/srv/state/reqmgr2/pid")
+		fs.StringVar(&c.name, "name", "", "executable name of the process")
+		fs.StringVar(&c.cmdline, "cmdline", "", "regular expression to match command line of the process")
+		fs.StringVar(&c.user, "user", "", "user name or id of the process owner")
+		fs.BoolVar(&c.children, "children", false, "monitor main process of the service and report aggregated metrics of its descendant processes")
+		fs.StringVar(&c.groups, "groups", "", "YAML file with named groups of processes to monitor, metrics of every group are labeled with its name")
+		return c
+	},
+}
+
+// config represents configuration of process collector
+type config struct {
+	uri       string
+	namespace string
+	pid       int
+	pidfile   string
+	name      string
+	cmdline   string
+	user      string
+	children  bool
+	groups    string
+}
+
+// Namespace implements exporter.Config interface
+func (c *config) Namespace() string {
+	return c.namespace
+}
+
+// Target implements exporter.TargetConfig interface
+func (c *config) Target() string {
+	groups, err := c.processGroups()
+	if err != nil {
+		return fmt.Sprintf("pid %d", c.pid)
+	}
+	if c.groups != "" {
+		return fmt.Sprintf("groups %s", groupNames(groups))
+	}
+	return groups[0].selector.String()
+}
+
+// NewCollector implements exporter.Config interface
+func (c *config) NewCollector(env *exporter.Env) (prometheus.Collector, error) {
+	groups, err := c.processGroups()
+	if err != nil {
+		return nil, err
+	}
+	return newExporter(c.uri, c.namespace, groups), nil
+}
+
+// helper function to return groups of processes to monitor, without groups
+// file single unnamed group is defined by command line options
+func (c *config) processGroups() ([]group, error) {
+	if c.groups != "" {
+		if c.pid != 0 || c.pidfile != "" || c.name != "" || c.cmdline != "" || c.user != "" {
+			return nil, fmt.Errorf("groups option can't be combined with other process selection options")
+		}
+		return loadGroups(c.groups, c.children)
+	}
+	sel, err := newSelector(c.pid, c.pidfile, c.name, c.cmdline, c.user)
+	if err != nil {
+		return nil, err
+	}
+	return []group{{selector: sel, children: c.children}}, nil
+}
+
+type Exporter struct {
+	URI    string
+	PID    int // PID of the process without groups file, it is resolved on every scrape
+	groups []group
+	cpu    *cpuTracker // CPU samples of processes kept across scrapes
+	mutex  sync.Mutex
+
+	scrapeMetrics *scrape.Metrics
+
+	// metrics from process collector
+	cpuTotal        *prometheus.Desc
+	openFDs, maxFDs *prometheus.Desc
+	vsize, maxVsize *prometheus.Desc
+	rss             *prometheus.Desc
+	pss             *prometheus.Desc
+	startTime       *prometheus.Desc
+
+	// I/O, scheduling and paging metrics of the process
+	readBytes, writeBytes       *prometheus.Desc
+	readChars, writeChars       *prometheus.Desc
+	readSyscalls, writeSyscalls *prometheus.Desc
+	volCtxSwitches              *prometheus.Desc
+	nonVolCtxSwitches           *prometheus.Desc
+	minorFaults, majorFaults    *prometheus.Desc
+
+	// node specific metrics
+	memPercent  *prometheus.Desc
+	memTotal    *prometheus.Desc
+	memFree     *prometheus.Desc
+	swapPercent *prometheus.Desc
+	swapTotal   *prometheus.Desc
+	swapFree    *prometheus.Desc
+	cpuPercent  *prometheus.Desc
+	numThreads  *prometheus.Desc
+	numCpus     *prometheus.Desc
+	load1       *prometheus.Desc
+	load5       *prometheus.Desc
+	load15      *prometheus.Desc
+
+	//process specific metrics
+	procCpu   *prometheus.Desc
+	topCpu    *prometheus.Desc
+	threadCpu *prometheus.Desc
+	procMem   *prometheus.Desc
+	openFiles *prometheus.Desc
+	totCon    *prometheus.Desc
+	lisCon    *prometheus.Desc
+	estCon    *prometheus.Desc
+	closeCon  *prometheus.Desc
+	timeCon   *prometheus.Desc
+	procs     *prometheus.Desc
+
+	// aggregated metrics of descendant processes
+	children         *prometheus.Desc
+	childrenCpu      *prometheus.Desc
+	childrenRss      *prometheus.Desc
+	childrenPss      *prometheus.Desc
+	childrenFDs      *prometheus.Desc
+	childrenThreads  *prometheus.Desc
+	childrenTotalCon *prometheus.Desc
+}
+
+// NewExporter creates exporter of the process with given PID
+func NewExporter(uri, namespace string, pid int) *Exporter {
+	return newExporter(uri, namespace, []group{{selector: &selector{pid: pid}}})
+}
+
+// helper function to create exporter of given groups of processes, metrics
+// of named groups have group label
+func newExporter(uri, namespace string, groups []group) *Exporter {
+	var labels []string
+	if groups[0].name != "" {
+		labels = []string{"group"}
+	}
+	return &Exporter{
+		URI:           uri,
+		PID:           groups[0].selector.pid,
+		groups:        groups,
+		cpu:           newCPUTracker(),
+		scrapeMetrics: scrape.NewMetrics(namespace),
+		// metrics from process collector
+		cpuTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_cpu_seconds_total"),
+			"Total user and system CPU time spent in seconds (process collector)",
+			labels, nil,
+		),
+		openFDs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_open_fds"),
+			"Number of open file descriptors (process collector)",
+			labels, nil,
+		),
+		maxFDs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_max_fds"),
+			"Maximum number of open file descriptors (process collector)",
+			labels, nil,
+		),
+		vsize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_virtual_memory_bytes"),
+			"Virtual memory size in bytes (process collector)",
+			labels, nil,
+		),
+		maxVsize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_virtual_memory_max_bytes"),
+			"Maximum amount of virtual memory available in bytes (process collector)",
+			labels, nil,
+		),
+		rss: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_resident_memory_bytes"),
+			"Resident memory size in bytes (process collector)",
+			labels, nil,
+		),
+		pss: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_pss_bytes"),
+			"Proportional set size of the process in bytes",
+			labels, nil,
+		),
+		startTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_start_time_seconds"),
+			"Start time of the process since unix epoch in seconds, the earliest one of the group",
+			labels, nil,
+		),
+		readBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_read_bytes_total"),
+			"Number of bytes read from storage layer by the process",
+			labels, nil,
+		),
+		writeBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_write_bytes_total"),
+			"Number of bytes written to storage layer by the process",
+			labels, nil,
+		),
+		readChars: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_read_chars_total"),
+			"Number of bytes read by the process via read syscalls, including sockets and FUSE mounts",
+			labels, nil,
+		),
+		writeChars: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_write_chars_total"),
+			"Number of bytes written by the process via write syscalls, including sockets and FUSE mounts",
+			labels, nil,
+		),
+		readSyscalls: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_read_syscalls_total"),
+			"Number of read syscalls of the process",
+			labels, nil,
+		),
+		writeSyscalls: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_write_syscalls_total"),
+			"Number of write syscalls of the process",
+			labels, nil,
+		),
+		volCtxSwitches: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_voluntary_context_switches_total"),
+			"Number of voluntary context switches of the process",
+			labels, nil,
+		),
+		nonVolCtxSwitches: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_involuntary_context_switches_total"),
+			"Number of involuntary context switches of the process",
+			labels, nil,
+		),
+		minorFaults: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_minor_page_faults_total"),
+			"Number of minor page faults of the process",
+			labels, nil,
+		),
+		majorFaults: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "process_major_page_faults_total"),
+			"Number of major page faults of the process, i.e. ones which required loading pages from disk",
+			labels, nil,
+		),
+
+		// custom metrics
+		memPercent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "memory_percent"),
+			"Virtual memory usage of the server",
+			nil,
+			nil),
+		memTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "memory_total"),
+			"Virtual total memory usage of the server",
+			nil,
+			nil),
+		memFree: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "memory_free"),
+			"Virtual free memory usage of the server",
+			nil,
+			nil),
+		swapPercent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "swap_percent"),
+			"Swap memory usage of the server",
+			nil,
+			nil),
+		swapTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "swap_total"),
+			"Virtual total swap usage of the server",
+			nil,
+			nil),
+		swapFree: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "swap_free"),
+			"Virtual free swap usage of the server",
+			nil,
+			nil),
+		cpuPercent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "cpu_percent"),
+			"cpu percent of the server",
+			nil,
+			nil),
+		numThreads: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "num_threads"),
+			"Number of threads",
+			labels,
+			nil),
+		numCpus: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "num_cpus"),
+			"Number of CPUs usable by the current process",
+			nil,
+			nil),
+		load1: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "load1"),
+			"Load average in last 1m",
+			nil,
+			nil),
+		load5: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "load5"),
+			"Load average in last 5m",
+			nil,
+			nil),
+		load15: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "load15"),
+			"Load average in last 15m",
+			nil,
+			nil),
+		topCpu: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "top_cpu"),
+			"process CPU usage in percent since previous scrape, computed from /proc/PID/stat",
+			labels,
+			nil),
+		threadCpu: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "thread_cpu_max"),
+			"highest CPU usage of single thread of the process in percent since previous scrape",
+			labels,
+			nil),
+		procCpu: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_cpu"),
+			"process CPU",
+			labels,
+			nil),
+		procMem: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "proc_mem"),
+			"process memory",
+			labels,
+			nil),
+		openFiles: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "open_files"),
+			"Number of open files",
+			labels,
+			nil),
+		totCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "total_connections"),
+			"Server TOTAL number of connections",
+			labels,
+			nil),
+		lisCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "listen_connections"),
+			"Server LISTEN number of connections",
+			labels,
+			nil),
+		estCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "established_connections"),
+			"Server ESTABLISHED number of connections",
+			labels,
+			nil),
+		closeCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "close_wait_connections"),
+			"Server CLOSE_WAIT number of connections",
+			labels,
+			nil),
+		timeCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "time_wait_connections"),
+			"Server TIME_WAIT number of connections",
+			labels,
+			nil),
+		procs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "processes"),
+			"Number of monitored processes",
+			labels,
+			nil),
+		children: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "children"),
+			"Number of descendant processes of monitored processes",
+			labels,
+			nil),
+		childrenCpu: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "children_cpu"),
+			"CPU usage of descendant processes in percent since previous scrape",
+			labels,
+			nil),
+		childrenRss: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "children_resident_memory_bytes"),
+			"Resident memory size of descendant processes in bytes",
+			labels,
+			nil),
+		childrenPss: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "children_pss_bytes"),
+			"Proportional set size of descendant processes in bytes",
+			labels,
+			nil),
+		childrenFDs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "children_open_fds"),
+			"Number of open file descriptors of descendant processes",
+			labels,
+			nil),
+		childrenThreads: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "children_num_threads"),
+			"Number of threads of descendant processes",
+			labels,
+			nil),
+		childrenTotalCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "children_total_connections"),
+			"TOTAL number of connections of descendant processes",
+			labels,
+			nil),
+	}
+}
+
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.scrapeMetrics.Describe(ch)
+	// metrics from process collector
+	ch <- e.cpuTotal
+	ch <- e.openFDs
+	ch <- e.maxFDs
+	ch <- e.vsize
+	ch <- e.maxVsize
+	ch <- e.rss
+	ch <- e.pss
+	ch <- e.startTime
+	ch <- e.readBytes
+	ch <- e.writeBytes
+	ch <- e.readChars
+	ch <- e.writeChars
+	ch <- e.readSyscalls
+	ch <- e.writeSyscalls
+	ch <- e.volCtxSwitches
+	ch <- e.nonVolCtxSwitches
+	ch <- e.minorFaults
+	ch <- e.majorFaults
+	// node specific metrics
+	ch <- e.memPercent
+	ch <- e.memTotal
+	ch <- e.memFree
+	ch <- e.swapPercent
+	ch <- e.swapTotal
+	ch <- e.swapFree
+	ch <- e.numThreads
+	ch <- e.cpuPercent
+	ch <- e.numCpus
+	ch <- e.load1
+	ch <- e.load5
+	ch <- e.load15
+	// process specific metrics
+	ch <- e.topCpu
+	ch <- e.threadCpu
+	ch <- e.procCpu
+	ch <- e.procMem
+	ch <- e.openFiles
+	ch <- e.totCon
+	ch <- e.lisCon
+	ch <- e.estCon
+	ch <- e.closeCon
+	ch <- e.timeCon
+	ch <- e.procs
+	// descendant processes
+	ch <- e.children
+	ch <- e.childrenCpu
+	ch <- e.childrenRss
+	ch <- e.childrenPss
+	ch <- e.childrenFDs
+	ch <- e.childrenThreads
+	ch <- e.childrenTotalCon
+}
+
+// Collect performs metrics collectio of exporter attributes
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext performs metrics collection within context of the scrape
+func (e *Exporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	e.mutex.Lock() // To protect metrics from concurrent collects.
+	defer e.mutex.Unlock()
+	start := time.Now()
+	err := e.collect(ctx, ch)
+	if err != nil {
+		log.Printf("Error scraping: %s", err)
+	}
+	e.scrapeMetrics.Collect(ch, start, err)
+}
+
+// LastScrape returns status of last scrape of the source
+func (e *Exporter) LastScrape() scrape.Status {
+	return e.scrapeMetrics.Last()
+}
+
+// helper function which collects exporter attributes
+func (e *Exporter) collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var mempct, memtot, memfree float64
+	if v, e := mem.VirtualMemory(); e == nil {
+		mempct = v.UsedPercent
+		memtot = float64(v.Total)
+		memfree = float64(v.Free)
+	}
+	var swappct, swaptot, swapfree float64
+	if v, e := mem.SwapMemory(); e == nil {
+		swappct = v.UsedPercent
+		swaptot = float64(v.Total)
+		swapfree = float64(v.Free)
+	}
+	var cpupct float64
+	// Percent calculates the percentage of cpu used either per CPU or combined.
+	// If an interval of 0 is given it will compare the current cpu times against the last call.
+	// Returns one value per cpu, or a single value if percpu is set to false.
+	if c, e := cpu.Percent(time.Millisecond, false); e == nil {
+		for _, v := range c {
+			cpupct += v
+		}
+		//         cpupct = c[0] // one value since we didn't ask per cpu
+	}
+	var load1, load5, load15 float64
+	if l, e := load.Avg(); e == nil {
+		load1 = l.Load1
+		load5 = l.Load5
+		load15 = l.Load15
+	}
+
+	// node specific metrics
+	ch <- prometheus.MustNewConstMetric(e.memPercent, prometheus.CounterValue, mempct)
+	ch <- prometheus.MustNewConstMetric(e.memTotal, prometheus.CounterValue, memtot)
+	ch <- prometheus.MustNewConstMetric(e.memFree, prometheus.CounterValue, memfree)
+	ch <- prometheus.MustNewConstMetric(e.swapPercent, prometheus.CounterValue, swappct)
+	ch <- prometheus.MustNewConstMetric(e.swapTotal, prometheus.CounterValue, swaptot)
+	ch <- prometheus.MustNewConstMetric(e.swapFree, prometheus.CounterValue, swapfree)
+	ch <- prometheus.MustNewConstMetric(e.numCpus, prometheus.CounterValue, float64(runtime.NumCPU()))
+	ch <- prometheus.MustNewConstMetric(e.load1, prometheus.CounterValue, load1)
+	ch <- prometheus.MustNewConstMetric(e.load5, prometheus.CounterValue, load5)
+	ch <- prometheus.MustNewConstMetric(e.load15, prometheus.CounterValue, load15)
+	ch <- prometheus.MustNewConstMetric(e.cpuPercent, prometheus.CounterValue, cpupct)
+
+	// process specific metrics of every group, the scrape fails only if
+	// none of the groups has running processes
+	var errs []string
+	for _, g := range e.groups {
+		if err := e.collectGroup(g, ch); err != nil {
+			if g.name != "" {
+				err = fmt.Errorf("group %s: %v", g.name, err)
+			}
+			errs = append(errs, err.Error())
+		}
+	}
+	e.cpu.sweep()
+	if len(errs) == len(e.groups) {
+		return scrape.Errorf(scrape.ReasonOther, "unable to read processes: %s", strings.Join(errs, "; "))
+	}
+	for _, msg := range errs {
+		log.Printf("ERROR: %s", msg)
+	}
+	return nil
+}
+
+// helper function which collects metrics of given group of processes
+func (e *Exporter) collectGroup(g group, ch chan<- prometheus.Metric) error {
+	var stats, cstats procStats
+	var nprocs, nchildren float64
+	var tree *procTree
+	pids, err := g.selector.resolve()
+	if err == nil && g.children {
+		// main processes are monitored while their descendants are
+		// aggregated separately
+		if tree, err = newProcTree(); err == nil {
+			pids = tree.roots(pids)
+		}
+	}
+	if err == nil {
+		if !g.all {
+			// if several processes match the one with highest PID is
+			// monitored as process_monitor.sh did, e.g. worker of the
+			// service, or the main process if its children are monitored
+			if g.children {
+				pids = pids[:1]
+			} else {
+				pids = pids[len(pids)-1:]
+			}
+			e.PID = pids[0]
+		}
+		for _, pid := range pids {
+			// process may exit after it was resolved
+			st, perr := e.processStats(pid)
+			if perr != nil {
+				err = fmt.Errorf("unable to read process %d: %v", pid, perr)
+				continue
+			}
+			stats.add(st)
+			nprocs += 1
+			if tree == nil {
+				continue
+			}
+			for _, child := range tree.descendants(pid) {
+				if st, perr := e.processStats(child); perr == nil {
+					cstats.add(st)
+					nchildren += 1
+				}
+			}
+		}
+		if nprocs > 0 {
+			err = nil
+		}
+	}
+
+	labels := g.labels()
+	// metrics from process collector
+	ch <- prometheus.MustNewConstMetric(e.cpuTotal, prometheus.CounterValue, stats.cpuTotal, labels...)
+	ch <- prometheus.MustNewConstMetric(e.openFDs, prometheus.CounterValue, stats.openFDs, labels...)
+	ch <- prometheus.MustNewConstMetric(e.maxFDs, prometheus.CounterValue, stats.maxFDs, labels...)
+	ch <- prometheus.MustNewConstMetric(e.vsize, prometheus.CounterValue, stats.vsize, labels...)
+	ch <- prometheus.MustNewConstMetric(e.maxVsize, prometheus.CounterValue, stats.maxVsize, labels...)
+	ch <- prometheus.MustNewConstMetric(e.rss, prometheus.CounterValue, stats.rss, labels...)
+	ch <- prometheus.MustNewConstMetric(e.pss, prometheus.GaugeValue, stats.pss, labels...)
+	ch <- prometheus.MustNewConstMetric(e.startTime, prometheus.GaugeValue, stats.startTime, labels...)
+	ch <- prometheus.MustNewConstMetric(e.readBytes, prometheus.CounterValue, stats.readBytes, labels...)
+	ch <- prometheus.MustNewConstMetric(e.writeBytes, prometheus.CounterValue, stats.writeBytes, labels...)
+	ch <- prometheus.MustNewConstMetric(e.readChars, prometheus.CounterValue, stats.readChars, labels...)
+	ch <- prometheus.MustNewConstMetric(e.writeChars, prometheus.CounterValue, stats.writeChars, labels...)
+	ch <- prometheus.MustNewConstMetric(e.readSyscalls, prometheus.CounterValue, stats.readSyscalls, labels...)
+	ch <- prometheus.MustNewConstMetric(e.writeSyscalls, prometheus.CounterValue, stats.writeSyscalls, labels...)
+	ch <- prometheus.MustNewConstMetric(e.volCtxSwitches, prometheus.CounterValue, stats.volCtxSwitches, labels...)
+	ch <- prometheus.MustNewConstMetric(e.nonVolCtxSwitches, prometheus.CounterValue, stats.nonVolCtxSwitches, labels...)
+	ch <- prometheus.MustNewConstMetric(e.minorFaults, prometheus.CounterValue, stats.minorFaults, labels...)
+	ch <- prometheus.MustNewConstMetric(e.majorFaults, prometheus.CounterValue, stats.majorFaults, labels...)
+	// process specific metrics
+	ch <- prometheus.MustNewConstMetric(e.topCpu, prometheus.GaugeValue, stats.topCpu, labels...)
+	ch <- prometheus.MustNewConstMetric(e.threadCpu, prometheus.GaugeValue, stats.threadCpu, labels...)
+	ch <- prometheus.MustNewConstMetric(e.procCpu, prometheus.CounterValue, stats.procCpu, labels...)
+	ch <- prometheus.MustNewConstMetric(e.procMem, prometheus.CounterValue, stats.procMem, labels...)
+	ch <- prometheus.MustNewConstMetric(e.numThreads, prometheus.CounterValue, stats.nThreads, labels...)
+	ch <- prometheus.MustNewConstMetric(e.openFiles, prometheus.CounterValue, stats.openFiles, labels...)
+	ch <- prometheus.MustNewConstMetric(e.totCon, prometheus.CounterValue, stats.totCon, labels...)
+	ch <- prometheus.MustNewConstMetric(e.lisCon, prometheus.CounterValue, stats.lisCon, labels...)
+	ch <- prometheus.MustNewConstMetric(e.estCon, prometheus.CounterValue, stats.estCon, labels...)
+	ch <- prometheus.MustNewConstMetric(e.closeCon, prometheus.CounterValue, stats.closeCon, labels...)
+	ch <- prometheus.MustNewConstMetric(e.timeCon, prometheus.CounterValue, stats.timeCon, labels...)
+	ch <- prometheus.MustNewConstMetric(e.procs, prometheus.GaugeValue, nprocs, labels...)
+	if g.children {
+		ch <- prometheus.MustNewConstMetric(e.children, prometheus.GaugeValue, nchildren, labels...)
+		ch <- prometheus.MustNewConstMetric(e.childrenCpu, prometheus.GaugeValue, cstats.topCpu, labels...)
+		ch <- prometheus.MustNewConstMetric(e.childrenRss, prometheus.GaugeValue, cstats.rss, labels...)
+		ch <- prometheus.MustNewConstMetric(e.childrenPss, prometheus.GaugeValue, cstats.pss, labels...)
+		ch <- prometheus.MustNewConstMetric(e.childrenFDs, prometheus.GaugeValue, cstats.openFDs, labels...)
+		ch <- prometheus.MustNewConstMetric(e.childrenThreads, prometheus.GaugeValue, cstats.nThreads, labels...)
+		ch <- prometheus.MustNewConstMetric(e.childrenTotalCon, prometheus.GaugeValue, cstats.totCon, labels...)
+	}
+	return err
+}
+
+// procStats represents metrics of a process or sum of metrics of several processes
+type procStats struct {
+	cpuTotal, vsize, rss, pss, openFDs, maxFDs, maxVsize           float64
+	topCpu, threadCpu, procCpu, procMem, nThreads                  float64
+	openFiles                                                      float64
+	estCon, lisCon, othCon, totCon, closeCon, timeCon              float64
+	startTime, readBytes, writeBytes, readChars, writeChars        float64
+	readSyscalls, writeSyscalls, volCtxSwitches, nonVolCtxSwitches float64
+	minorFaults, majorFaults                                       float64
+}
+
+// helper function to add metrics of another process, limits of processes
+// are not summed up, the lowest limit is reported, as well as the highest
+// CPU usage of single thread and the earliest start time
+func (s *procStats) add(o procStats) {
+	if s.startTime == 0 || (o.startTime > 0 && o.startTime < s.startTime) {
+		s.startTime = o.startTime
+	}
+	if o.threadCpu > s.threadCpu {
+		s.threadCpu = o.threadCpu
+	}
+	if s.maxFDs == 0 || (o.maxFDs > 0 && o.maxFDs < s.maxFDs) {
+		s.maxFDs = o.maxFDs
+	}
+	if s.maxVsize == 0 || (o.maxVsize > 0 && o.maxVsize < s.maxVsize) {
+		s.maxVsize = o.maxVsize
+	}
+	s.cpuTotal += o.cpuTotal
+	s.vsize += o.vsize
+	s.rss += o.rss
+	s.pss += o.pss
+	s.openFDs += o.openFDs
+	s.topCpu += o.topCpu
+	s.procCpu += o.procCpu
+	s.procMem += o.procMem
+	s.nThreads += o.nThreads
+	s.openFiles += o.openFiles
+	s.estCon += o.estCon
+	s.lisCon += o.lisCon
+	s.othCon += o.othCon
+	s.totCon += o.totCon
+	s.closeCon += o.closeCon
+	s.timeCon += o.timeCon
+	s.readBytes += o.readBytes
+	s.writeBytes += o.writeBytes
+	s.readChars += o.readChars
+	s.writeChars += o.writeChars
+	s.readSyscalls += o.readSyscalls
+	s.writeSyscalls += o.writeSyscalls
+	s.volCtxSwitches += o.volCtxSwitches
+	s.nonVolCtxSwitches += o.nonVolCtxSwitches
+	s.minorFaults += o.minorFaults
+	s.majorFaults += o.majorFaults
+}
+
+// helper function which collects metrics of process with given PID
+func (e *Exporter) processStats(pid int) (procStats, error) {
+	var s procStats
+	proc, err := procfs.NewProc(pid)
+	if err != nil {
+		return s, err
+	}
+	if stat, err := proc.Stat(); err == nil {
+		// CPUTime returns the total CPU user and system time in seconds.
+		s.cpuTotal = float64(stat.CPUTime())
+		s.vsize = float64(stat.VirtualMemory())
+		s.rss = float64(stat.ResidentMemory())
+		// CPU usage of the process and its threads since previous scrape
+		s.topCpu, s.threadCpu = e.cpu.usage(proc, stat)
+		s.startTime = e.cpu.startTime(stat)
+		s.minorFaults = float64(stat.MinFlt)
+		s.majorFaults = float64(stat.MajFlt)
+	}
+	if io, err := proc.IO(); err == nil {
+		s.readBytes = float64(io.ReadBytes)
+		s.writeBytes = float64(io.WriteBytes)
+		s.readChars = float64(io.RChar)
+		s.writeChars = float64(io.WChar)
+		s.readSyscalls = float64(io.SyscR)
+		s.writeSyscalls = float64(io.SyscW)
+	}
+	if status, err := proc.NewStatus(); err == nil {
+		s.volCtxSwitches = float64(status.VoluntaryCtxtSwitches)
+		s.nonVolCtxSwitches = float64(status.NonVoluntaryCtxtSwitches)
+	}
+	if rollup, err := proc.ProcSMapsRollup(); err == nil {
+		s.pss = float64(rollup.Pss)
+	}
+	if fds, err := proc.FileDescriptorsLen(); err == nil {
+		s.openFDs = float64(fds)
+	}
+	if limits, err := proc.NewLimits(); err == nil {
+		s.maxFDs = float64(limits.OpenFiles)
+		s.maxVsize = float64(limits.AddressSpace)
+	}
+
+	if proc, err := psprocess.NewProcess(int32(pid)); err == nil {
+		// CPU_Percent returns how many percent of the CPU time this process uses
+		if v, e := proc.CPUPercent(); e == nil {
+			s.procCpu = float64(v)
+		}
+		if v, e := proc.MemoryPercent(); e == nil {
+			s.procMem = float64(v)
+		}
+
+		if v, e := proc.NumThreads(); e == nil {
+			s.nThreads = float64(v)
+		}
+		if connections, e := proc.Connections(); e == nil {
+			for _, v := range connections {
+				if v.Status == "LISTEN" {
+					s.lisCon += 1
+				} else if v.Status == "ESTABLISHED" {
+					s.estCon += 1
+				} else if v.Status == "TIME_WAIT" {
+					s.timeCon += 1
+				} else if v.Status == "CLOSE_WAIT" {
+					s.closeCon += 1
+				} else {
+					s.othCon += 1
+				}
+			}
+			s.totCon = s.lisCon + s.estCon + s.timeCon + s.closeCon + s.othCon
+		}
+		if oFiles, e := proc.OpenFiles(); e == nil {
+			s.openFiles = float64(len(oFiles))
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,169 @@
+package process
+
+// Discovery of processes monitored by process exporter.
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/procfs"
+)
+
+// selector defines how to find process to monitor, it is resolved on every
+// scrape to follow restarts of the process
+type selector struct {
+	pid     int            // fixed PID of the process
+	pidfile string         // file with PID or process group id, e.g. /data/srv/state/reqmgr2/pid
+	name    string         // executable name of the process
+	cmdline *regexp.Regexp // regular expression matched against command line of the process
+	user    string         // user name or id of the process owner
+	uid     string         // user id of the process owner
+}
+
+// helper function to create selector from given options
+func newSelector(pid int, pidfile, name, cmdline, owner string) (*selector, error) {
+	s := &selector{pid: pid, pidfile: pidfile, name: name, user: owner}
+	matchers := name != "" || cmdline != "" || owner != ""
+	if pid != 0 && (pidfile != "" || matchers) {
+		return nil, fmt.Errorf("pid option can't be combined with other process selection options")
+	}
+	if pidfile != "" && matchers {
+		return nil, fmt.Errorf("pidfile option can't be combined with name, cmdline or user options")
+	}
+	if pid == 0 && pidfile == "" && !matchers {
+		return nil, fmt.Errorf("one of pid, pidfile, name, cmdline or user options is required")
+	}
+	if cmdline != "" {
+		re, err := regexp.Compile(cmdline)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cmdline pattern: %v", err)
+		}
+		s.cmdline = re
+	}
+	if owner != "" {
+		if u, err := user.Lookup(owner); err == nil {
+			s.uid = u.Uid
+		} else if _, e := strconv.Atoi(owner); e == nil {
+			s.uid = owner
+		} else {
+			return nil, fmt.Errorf("unknown user %s: %v", owner, err)
+		}
+	}
+	return s, nil
+}
+
+// String returns description of the selector
+func (s *selector) String() string {
+	if s.pid != 0 {
+		return fmt.Sprintf("pid %d", s.pid)
+	}
+	if s.pidfile != "" {
+		return fmt.Sprintf("pidfile %s", s.pidfile)
+	}
+	var out []string
+	if s.name != "" {
+		out = append(out, fmt.Sprintf("name %s", s.name))
+	}
+	if s.cmdline != nil {
+		out = append(out, fmt.Sprintf("cmdline %s", s.cmdline))
+	}
+	if s.user != "" {
+		out = append(out, fmt.Sprintf("user %s", s.user))
+	}
+	return strings.Join(out, ", ")
+}
+
+// resolve returns PIDs of matching processes in ascending order
+func (s *selector) resolve() ([]int, error) {
+	if s.pid != 0 {
+		return []int{s.pid}, nil
+	}
+	if s.pidfile != "" {
+		return s.group()
+	}
+	procs, err := procfs.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var pids []int
+	for _, proc := range procs {
+		if proc.PID == self {
+			continue
+		}
+		if s.match(proc) {
+			pids = append(pids, proc.PID)
+		}
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no process matches %s", s)
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// helper function to resolve processes via pidfile, the file contains id of
+// the process group, e.g. PID of the service daemon, the processes of the
+// group are returned or the process itself if there is no such group
+func (s *selector) group() ([]int, error) {
+	data, err := os.ReadFile(s.pidfile)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content of %s: %v", s.pidfile, err)
+	}
+	procs, err := procfs.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, proc := range procs {
+		if stat, err := proc.Stat(); err == nil && stat.PGRP == gid {
+			pids = append(pids, proc.PID)
+		}
+	}
+	if len(pids) == 0 {
+		if _, err := procfs.NewProc(gid); err != nil {
+			return nil, fmt.Errorf("no process of %s found: %v", s.pidfile, err)
+		}
+		pids = append(pids, gid)
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// helper function to check if given process matches the selector, all
+// given criteria should match
+func (s *selector) match(proc procfs.Proc) bool {
+	var args []string
+	if s.name != "" || s.cmdline != nil {
+		var err error
+		if args, err = proc.CmdLine(); err != nil {
+			return false
+		}
+	}
+	if s.name != "" {
+		comm, _ := proc.Comm()
+		if comm != s.name && (len(args) == 0 || filepath.Base(args[0]) != s.name) {
+			return false
+		}
+	}
+	if s.cmdline != nil && !s.cmdline.MatchString(strings.Join(args, " ")) {
+		return false
+	}
+	if s.uid != "" {
+		status, err := proc.NewStatus()
+		if err != nil || status.UIDs[0] != s.uid {
+			return false
+		}
+	}
+	return true
+}
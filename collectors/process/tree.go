@@ -0,0 +1,81 @@
+package process
+
+// Process tree of the node used to aggregate metrics of child processes.
+
+import (
+	"sort"
+
+	"github.com/prometheus/procfs"
+)
+
+// procTree represents parent and child relations of processes of the node
+type procTree struct {
+	parent   map[int]int
+	children map[int][]int
+}
+
+// helper function to read process tree of the node
+func newProcTree() (*procTree, error) {
+	procs, err := procfs.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+	t := &procTree{parent: make(map[int]int), children: make(map[int][]int)}
+	for _, proc := range procs {
+		stat, err := proc.Stat()
+		if err != nil {
+			// process may exit in a meantime
+			continue
+		}
+		t.parent[proc.PID] = stat.PPID
+		t.children[stat.PPID] = append(t.children[stat.PPID], proc.PID)
+	}
+	return t, nil
+}
+
+// helper function to return all descendants of given process
+func (t *procTree) descendants(pid int) []int {
+	var out []int
+	// processes are read one by one, therefore reuse of PIDs may produce
+	// loops in the tree
+	seen := map[int]bool{pid: true}
+	queue := t.children[pid]
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		out = append(out, child)
+		queue = append(queue, t.children[child]...)
+	}
+	return out
+}
+
+// helper function to return processes from given list which are not
+// descendants of other processes of the list, e.g. main process of the
+// service among its workers, in ascending order
+func (t *procTree) roots(pids []int) []int {
+	set := make(map[int]bool)
+	for _, pid := range pids {
+		set[pid] = true
+	}
+	var out []int
+	for _, pid := range pids {
+		root := true
+		// PID 1 and kernel threads have no parents within the tree, number
+		// of steps is limited to avoid loops caused by reuse of PIDs
+		for i, ppid := 0, t.parent[pid]; ppid > 1 && i < len(t.parent); i, ppid = i+1, t.parent[ppid] {
+			if set[ppid] {
+				root = false
+				break
+			}
+		}
+		if root {
+			out = append(out, pid)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
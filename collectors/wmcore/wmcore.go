@@ -0,0 +1,259 @@
+package wmcore
+
+// Author: Valentin Kuznetsov <vkuznet [AT] gmail {DOT} com>
+// Example of cmsweb data-service exporter for prometheus.io
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/exporter"
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// const (
+//     namespace = "wmcore" // For Prometheus metrics.
+// )
+
+// Collector describes wmcore collector
+var Collector = exporter.Collector{
+	Name:          "wmcore",
+	Description:   "WMCore data-service exporter",
+	AddressFlag:   "port",
+	Address:       ":18000",
+	NamespaceFlag: "namespace",
+	Auth:          true,
+	Flags: func(fs *flag.FlagSet) exporter.Config {
+		c := &config{}
+		fs.StringVar(&c.uri, "uri", "", "URI of server status page we're going to scrape")
+		fs.StringVar(&c.namespace, "namespace", "wmcore", "namespace for prometheus metrics")
+		return c
+	},
+}
+
+// config represents configuration of wmcore collector
+type config struct {
+	uri       string
+	namespace string
+}
+
+// Namespace implements exporter.Config interface
+func (c *config) Namespace() string {
+	return c.namespace
+}
+
+// NewCollector implements exporter.Config interface
+func (c *config) NewCollector(env *exporter.Env) (prometheus.Collector, error) {
+	return NewExporter(c.uri, c.namespace, env), nil
+}
+
+// UserDN function parses user Distinguished Name (DN) from client's HTTP request
+func UserDN(r *http.Request) string {
+	var names []interface{}
+	for _, cert := range r.TLS.PeerCertificates {
+		for _, name := range cert.Subject.Names {
+			switch v := name.Value.(type) {
+			case string:
+				names = append(names, v)
+			}
+		}
+	}
+	parts := names[:7]
+	return fmt.Sprintf("/DC=%s/DC=%s/OU=%s/OU=%s/CN=%s/CN=%s/CN=%s", parts...)
+}
+
+type Exporter struct {
+	URI     string
+	mutex   sync.Mutex
+	client  *http.Client
+	verbose bool
+
+	scrapeMetrics *scrape.Metrics
+	uptime        *prometheus.Desc
+	connections   *prometheus.GaugeVec
+	memPercent    *prometheus.Desc
+	swapPercent   *prometheus.Desc
+	cpuPercent    *prometheus.Desc
+	numThreads    *prometheus.Desc
+	openFiles     *prometheus.Desc
+	totCon        *prometheus.Desc
+	lisCon        *prometheus.Desc
+	estCon        *prometheus.Desc
+}
+
+func NewExporter(uri, namespace string, env *exporter.Env) *Exporter {
+	return &Exporter{
+		URI:           uri,
+		client:        env.Client,
+		verbose:       env.Verbose,
+		scrapeMetrics: scrape.NewMetrics(namespace),
+		uptime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "uptime"),
+			"Current uptime in seconds",
+			nil,
+			nil),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connections",
+			Help:      "connection statuses",
+		},
+			[]string{"state"},
+		),
+		memPercent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "memory_percent"),
+			"Virtual memory usage of the server",
+			nil,
+			nil),
+		cpuPercent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "cpu_percent"),
+			"cpu percent of the server",
+			nil,
+			nil),
+		numThreads: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "num_threads"),
+			"Number of threads or Go routines",
+			nil,
+			nil),
+		openFiles: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "open_files"),
+			"Number of open files",
+			nil,
+			nil),
+		totCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "total_connections"),
+			"Server TOTAL number of connections",
+			nil,
+			nil),
+		lisCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "listen_connections"),
+			"Server LISTEN number of connections",
+			nil,
+			nil),
+		estCon: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "established_connections"),
+			"Server ESTABLISHED number of connections",
+			nil,
+			nil),
+	}
+}
+
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.scrapeMetrics.Describe(ch)
+	ch <- e.uptime
+	ch <- e.memPercent
+	ch <- e.cpuPercent
+	ch <- e.numThreads
+	ch <- e.openFiles
+	ch <- e.totCon
+	ch <- e.lisCon
+	ch <- e.estCon
+}
+
+// Collect performs metrics collectio of exporter attributes
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext performs metrics collection within context of the scrape
+func (e *Exporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	e.mutex.Lock() // To protect metrics from concurrent collects.
+	defer e.mutex.Unlock()
+	start := time.Now()
+	err := e.collect(ctx, ch)
+	if err != nil {
+		log.Printf("Error scraping: %s", err)
+	}
+	e.scrapeMetrics.Collect(ch, start, err)
+}
+
+// LastScrape returns status of last scrape of the source
+func (e *Exporter) LastScrape() scrape.Status {
+	return e.scrapeMetrics.Last()
+}
+
+// helper function which collects exporter attributes
+func (e *Exporter) collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	// here is an example how we may collect server stats
+	// we'll make an HTTP call to server URI which will return
+	// status as a JSON document, then we'll assign metrics using JSON values
+	var req *http.Request
+	req, _ = http.NewRequestWithContext(ctx, "GET", e.URI, nil)
+	req.Header.Add("Accept-Encoding", "identity")
+	req.Header.Add("Accept", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error scraping apache: %w", err)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		return scrape.Errorf(scrape.ReasonHTTPStatus, "Status %s (%d): %s", resp.Status, resp.StatusCode, data)
+	}
+	var rec map[string]interface{}
+	err = json.Unmarshal(data, &rec)
+	if err != nil {
+		return scrape.Errorf(scrape.ReasonDecode, "Fail to unmarshal JSON data %s", err.Error())
+	}
+	if e.verbose {
+		fmt.Println(string(data))
+	}
+	var mempct, cpupct float64
+	if v, ok := rec["memory_percent"]; ok {
+		mempct = v.(float64)
+	}
+	if v, ok := rec["cpu_percent"]; ok {
+		cpupct = v.(float64)
+	}
+	var nthr float64
+	if v, ok := rec["num_threads"]; ok {
+		nthr = v.(float64)
+	}
+	var openFiles float64
+	if v, ok := rec["OpenFiles"]; ok {
+		files := v.([]interface{})
+		openFiles = float64(len(files))
+	}
+	var uptime float64
+	if v, ok := rec["uptime"]; ok {
+		uptime = v.(float64)
+	}
+	var totCon, estCon, lisCon float64
+	if v, ok := rec["Connections"]; ok {
+		switch connections := v.(type) {
+		case []interface{}:
+			for _, c := range connections {
+				con := c.(map[string]interface{})
+				v, _ := con["status"]
+				switch v {
+				case "ESTABLISHED":
+					estCon += 1
+				case "LISTEN":
+					lisCon += 1
+				}
+			}
+			totCon = float64(len(connections))
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(e.uptime, prometheus.CounterValue, uptime)
+	ch <- prometheus.MustNewConstMetric(e.memPercent, prometheus.CounterValue, mempct)
+	ch <- prometheus.MustNewConstMetric(e.cpuPercent, prometheus.CounterValue, cpupct)
+	ch <- prometheus.MustNewConstMetric(e.numThreads, prometheus.CounterValue, nthr)
+	ch <- prometheus.MustNewConstMetric(e.openFiles, prometheus.CounterValue, openFiles)
+	ch <- prometheus.MustNewConstMetric(e.totCon, prometheus.CounterValue, totCon)
+	ch <- prometheus.MustNewConstMetric(e.lisCon, prometheus.CounterValue, lisCon)
+	ch <- prometheus.MustNewConstMetric(e.estCon, prometheus.CounterValue, estCon)
+	return nil
+}
@@ -0,0 +1,362 @@
+package exporter
+
+// YAML configuration file of cmsweb exporters. The same file format is used
+// by standalone exporters and by cmsweb-exporter which runs several
+// collectors within single process sharing one HTTP server and one
+// credential manager. Values given on command line override file values.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dmwm/cmsweb-exporters/version"
+	"github.com/dmwm/cmsweb-exporters/web"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+// ServerConfig represents configuration file of exporters, e.g.
+//
+//	listen_address: ":18000"
+//	metrics_path: /metrics
+//	credentials:
+//	  proxyfile: /etc/proxy/proxy
+//	  capath: /etc/grid-security/certificates
+//	collectors:
+//	  - name: das2go
+//	    uri: http://localhost:8217/das/status
+//	    timeout: 5
+//	  - name: process
+//	    namespace: das2go_process
+//	    poll_interval: 30
+//	    flags:
+//	      pid: 1234
+type ServerConfig struct {
+	ListenAddress   string            `yaml:"listen_address"`    // address to expose metrics on
+	MetricsPath     string            `yaml:"metrics_path"`      // path under which to expose metrics
+	Namespace       string            `yaml:"namespace"`         // namespace of credential manager metrics, used by cmsweb-exporter only
+	ReloadTokenFile string            `yaml:"reload_token_file"` // file with bearer token of /-/reload endpoint
+	WebConfigFile   string            `yaml:"web_config_file"`   // web configuration file with TLS and basic authentication settings
+	Verbose         *bool             `yaml:"verbose"`           // verbose output
+	Credentials     CredentialsConfig `yaml:"credentials"`       // credentials to access cmsweb services
+	Collectors      []CollectorConfig `yaml:"collectors"`        // collectors to run
+}
+
+// CredentialsConfig represents credentials used by exporters
+type CredentialsConfig struct {
+	ProxyFile        string   `yaml:"proxyfile"`          // proxy file name
+	CACert           string   `yaml:"cacert"`             // CA bundle file
+	CAPath           string   `yaml:"capath"`             // directory with CA certificates
+	Insecure         *bool    `yaml:"insecure"`           // skip verification of server certificates
+	TokenFile        string   `yaml:"tokenfile"`          // file with bearer token
+	TokenURL         string   `yaml:"token_url"`          // token endpoint of client credentials flow
+	ClientID         string   `yaml:"client_id"`          // client id of client credentials flow
+	ClientSecretFile string   `yaml:"client_secret_file"` // file with client secret of client credentials flow
+	TokenScope       string   `yaml:"token_scope"`        // scopes to request for bearer token
+	TokenAudience    string   `yaml:"token_audience"`     // audience to request for bearer token
+	TokenHosts       []string `yaml:"token_hosts"`        // additional hosts which receive bearer token
+}
+
+// CollectorConfig represents configuration of single collector
+type CollectorConfig struct {
+	Name         string                 `yaml:"name"`          // name of the collector, e.g. das2go
+	URI          string                 `yaml:"uri"`           // target of the collector
+	Namespace    string                 `yaml:"namespace"`     // namespace of collector metrics
+	Timeout      int                    `yaml:"timeout"`       // timeout of requests to the target in seconds
+	PollInterval int                    `yaml:"poll_interval"` // background poll interval in seconds
+	Flags        map[string]interface{} `yaml:"flags"`         // values of other collector flags
+}
+
+// helper function to load configuration file
+func loadConfig(fname string) (ServerConfig, error) {
+	var cfg ServerConfig
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("unable to parse %s: %v", fname, err)
+	}
+	return cfg, nil
+}
+
+// helper function to convert server settings into flag values, addressFlag
+// is the name of listening address flag
+func (cfg ServerConfig) values(addressFlag string) map[string][]string {
+	values := make(map[string][]string)
+	add := func(name, value string) {
+		if value != "" {
+			values[name] = []string{value}
+		}
+	}
+	add(addressFlag, cfg.ListenAddress)
+	add("endpoint", cfg.MetricsPath)
+	add("reloadTokenFile", cfg.ReloadTokenFile)
+	add("webConfig", cfg.WebConfigFile)
+	if cfg.Verbose != nil {
+		add("verbose", fmt.Sprint(*cfg.Verbose))
+	}
+	cred := cfg.Credentials
+	add("proxyfile", cred.ProxyFile)
+	add("cacert", cred.CACert)
+	add("capath", cred.CAPath)
+	if cred.Insecure != nil {
+		add("insecure", fmt.Sprint(*cred.Insecure))
+	}
+	add("tokenfile", cred.TokenFile)
+	add("tokenURL", cred.TokenURL)
+	add("clientID", cred.ClientID)
+	add("clientSecretFile", cred.ClientSecretFile)
+	add("tokenScope", cred.TokenScope)
+	add("tokenAudience", cred.TokenAudience)
+	add("tokenHosts", strings.Join(cred.TokenHosts, ","))
+	return values
+}
+
+// helper function to convert collector settings into flag values of given
+// collector, list values are applied element by element to repeatable flags,
+// e.g. header option of http collector
+func (cc CollectorConfig) values(c Collector) (map[string][]string, error) {
+	values := make(map[string][]string)
+	for k, v := range cc.Flags {
+		if list, ok := v.([]interface{}); ok {
+			for _, elem := range list {
+				value, err := scalar(k, elem)
+				if err != nil {
+					return nil, err
+				}
+				values[k] = append(values[k], value)
+			}
+			continue
+		}
+		value, err := scalar(k, v)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = []string{value}
+	}
+	if cc.URI != "" {
+		values["uri"] = []string{cc.URI}
+	}
+	if cc.Namespace != "" {
+		if c.NamespaceFlag == "" {
+			return nil, fmt.Errorf("collector %s uses fixed namespace", c.Name)
+		}
+		values[c.NamespaceFlag] = []string{cc.Namespace}
+	}
+	if cc.Timeout != 0 {
+		values[c.timeoutFlag()] = []string{fmt.Sprint(cc.Timeout)}
+	}
+	if cc.PollInterval != 0 {
+		values["pollInterval"] = []string{fmt.Sprint(cc.PollInterval)}
+	}
+	return values, nil
+}
+
+// helper function to convert scalar YAML value of given option into flag value
+func scalar(name string, v interface{}) (string, error) {
+	switch v.(type) {
+	case []interface{}, map[interface{}]interface{}, map[string]interface{}:
+		return "", fmt.Errorf("option %s: unsupported value %v, scalar or list of scalars is expected", name, v)
+	}
+	return fmt.Sprint(v), nil
+}
+
+// helper function to apply given values to flags which were not set on
+// command line, in strict mode unknown flags are reported as errors
+func applyValues(fs *flag.FlagSet, values map[string][]string, strict bool) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	// apply flags in sorted order to get reproducible errors
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if set[k] {
+			continue
+		}
+		if fs.Lookup(k) == nil {
+			if strict {
+				return fmt.Errorf("unknown option %s", k)
+			}
+			continue
+		}
+		for _, value := range values[k] {
+			if err := fs.Set(k, value); err != nil {
+				return fmt.Errorf("option %s: %v", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// helper function to find collector with given name
+func find(collectors []Collector, name string) (Collector, bool) {
+	for _, c := range collectors {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Collector{}, false
+}
+
+// helper function to create collector instances from given configuration
+func instances(cfg ServerConfig, collectors []Collector) ([]*instance, error) {
+	var out []*instance
+	for idx, cc := range cfg.Collectors {
+		c, ok := find(collectors, cc.Name)
+		if !ok {
+			return nil, fmt.Errorf("collector #%d: unknown collector %q", idx, cc.Name)
+		}
+		fs := flag.NewFlagSet(cc.Name, flag.ContinueOnError)
+		inst := newInstance(c, fs)
+		values, err := cc.values(c)
+		if err == nil {
+			err = applyValues(fs, values, true)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("collector #%d (%s): %v", idx, cc.Name, err)
+		}
+		out = append(out, inst)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no collectors are configured")
+	}
+	return out, nil
+}
+
+// helper function to validate configuration of given collector instances,
+// collectors are created and registered with throwaway registry without
+// starting background polling
+func check(insts []*instance) error {
+	reg := prometheus.NewRegistry()
+	env := &Env{Client: &http.Client{}, PublicClient: &http.Client{}, Mux: http.NewServeMux()}
+	for _, inst := range insts {
+		collector, err := inst.newCollector(env)
+		if err != nil {
+			return err
+		}
+		if collector == nil {
+			continue
+		}
+		if err := reg.Register(collector); err != nil {
+			return fmt.Errorf("collector %s: %v", inst.collector.Name, err)
+		}
+	}
+	return nil
+}
+
+// helper function to report result of configuration check and exit
+func exitCheck(fname string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: FAILED: %v\n", fname, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: OK\n", fname)
+	os.Exit(0)
+}
+
+// RunConfig runs collectors defined in configuration file within single
+// process, all collectors share HTTP server and credential manager
+func RunConfig(name string, args []string, collectors []Collector) error {
+	return run(func(handling flag.ErrorHandling) (*settings, error) {
+		return serverSettings(name, args, collectors, handling)
+	})
+}
+
+// helper function to obtain settings of cmsweb-exporter from command line
+// arguments and configuration file
+func serverSettings(name string, args []string, collectors []Collector, handling flag.ErrorHandling) (*settings, error) {
+	fs := flag.NewFlagSet(name, handling)
+	config := fs.String("config", "", "YAML file with collectors to run")
+	configCheck := fs.Bool("config.check", false, "validate configuration file and exit")
+	address := fs.String("address", ":18000", "address to expose metrics on web interface.")
+	endpoint := fs.String("endpoint", "/metrics", "Path under which to expose metrics.")
+	namespace := fs.String("namespace", "cmsweb_exporter", "namespace for metrics of credential manager")
+	reloadTokenFile := fs.String("reloadTokenFile", "", "file with bearer token which enables POST /-/reload endpoint")
+	webConfig := fs.String("webConfig", "", "web configuration file with TLS and basic authentication settings")
+	verbose := fs.Bool("verbose", false, "verbose output")
+	showVersion := fs.Bool("version", false, "print version information and exit")
+	opts := authFlags(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s -config <config.yaml> [options]\n", name)
+		fmt.Fprintf(out, "       %s <collector> [collector options]\n", name)
+		fmt.Fprintln(out, "Collectors:")
+		for _, c := range collectors {
+			fmt.Fprintf(out, "  %-10s %s\n", c.Name, c.Description)
+		}
+		fmt.Fprintln(out, "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *showVersion {
+		fmt.Println(name, version.Info())
+		os.Exit(0)
+	}
+	if *config == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig(*config)
+	var insts []*instance
+	if err == nil {
+		values := cfg.values("address")
+		if cfg.Namespace != "" {
+			values["namespace"] = []string{cfg.Namespace}
+		}
+		err = applyValues(fs, values, true)
+	}
+	if err == nil {
+		insts, err = instances(cfg, collectors)
+	}
+	if err == nil {
+		err = authOptions(opts, insts)
+	}
+	if *configCheck {
+		if err == nil && *webConfig != "" {
+			_, err = web.Load(*webConfig)
+		}
+		if err == nil {
+			err = check(insts)
+		}
+		exitCheck(*config, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &settings{
+		name:            name,
+		address:         *address,
+		endpoint:        *endpoint,
+		namespace:       *namespace,
+		reloadTokenFile: *reloadTokenFile,
+		webConfigFile:   *webConfig,
+		verbose:         *verbose,
+		insts:           insts,
+	}
+	// use credential manager only if some collector needs it
+	var names []string
+	for _, inst := range insts {
+		if inst.collector.Auth {
+			opts.Namespace = *namespace
+			s.opts = opts
+		}
+		names = append(names, inst.collector.Name)
+	}
+	log.Printf("run collectors: %s", strings.Join(names, ", "))
+	return s, nil
+}
@@ -0,0 +1,136 @@
+package exporter
+
+// Tests of YAML configuration file of cmsweb exporters.
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// listFlag collects values of repeatable option
+type listFlag []string
+
+// String implements flag.Value interface
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+// Set implements flag.Value interface
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// testConfig represents configuration of test collector
+type testConfig struct {
+	namespace string
+	endpoint  string
+	headers   listFlag
+}
+
+// Namespace implements Config interface
+func (c *testConfig) Namespace() string {
+	return c.namespace
+}
+
+// NewCollector implements Config interface, it registers handler of the
+// endpoint similar to http collector
+func (c *testConfig) NewCollector(env *Env) (prometheus.Collector, error) {
+	env.Mux.HandleFunc(c.endpoint, func(w http.ResponseWriter, r *http.Request) {})
+	return nil, nil
+}
+
+// test collector with repeatable option and its own HTTP handler
+var testCollector = Collector{
+	Name:          "test",
+	NamespaceFlag: "namespace",
+	Flags: func(fs *flag.FlagSet) Config {
+		c := &testConfig{}
+		fs.StringVar(&c.namespace, "namespace", "test", "namespace of metrics")
+		fs.StringVar(&c.endpoint, "probeEndpoint", "/probe", "path of probe endpoint")
+		fs.Var(&c.headers, "header", "HTTP header, can be repeated")
+		return c
+	},
+}
+
+// helper function to load configuration from given YAML content
+func testInstances(t *testing.T, content string) ([]*instance, error) {
+	fname := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instances(cfg, []Collector{testCollector})
+}
+
+// TestListValues tests list values of repeatable options
+func TestListValues(t *testing.T) {
+	insts, err := testInstances(t, `
+collectors:
+  - name: test
+    flags:
+      header: ["X-One: 1", "X-Two: 2"]
+  - name: test
+    flags:
+      header: "X-Three: 3"
+      probeEndpoint: /probe2
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := [][]string{
+		{"X-One: 1", "X-Two: 2"},
+		{"X-Three: 3"},
+	}
+	for idx, want := range tests {
+		got := []string(insts[idx].config.(*testConfig).headers)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("collector #%d: headers %q, want %q", idx, got, want)
+		}
+	}
+	if err := check(insts); err != nil {
+		t.Errorf("check failed: %v", err)
+	}
+}
+
+// TestNonScalarValues tests rejection of values which can't be flag values
+func TestNonScalarValues(t *testing.T) {
+	tests := []string{
+		"header: {X-One: 1}",
+		"header: [[X-One: 1]]",
+		"header: [{X-One: 1}]",
+	}
+	for _, flags := range tests {
+		_, err := testInstances(t, "collectors:\n  - name: test\n    flags:\n      "+flags+"\n")
+		if err == nil || !strings.Contains(err.Error(), "option header") {
+			t.Errorf("%s: expected error of header option, got %v", flags, err)
+		}
+	}
+}
+
+// TestCheckDuplicateEndpoints tests validation of collectors registering
+// the same HTTP handler
+func TestCheckDuplicateEndpoints(t *testing.T) {
+	insts, err := testInstances(t, `
+collectors:
+  - name: test
+  - name: test
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = check(insts)
+	if err == nil || !strings.Contains(err.Error(), "/probe") {
+		t.Errorf("expected error of duplicate /probe endpoint, got %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package exporter
+
+// Common machinery to run cmsweb collectors either as standalone exporters
+// or several of them within single cmsweb-exporter process.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/auth"
+	"github.com/dmwm/cmsweb-exporters/cache"
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/dmwm/cmsweb-exporters/version"
+	"github.com/dmwm/cmsweb-exporters/web"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Env represents environment the collector runs in
+type Env struct {
+	Client       *http.Client   // HTTP client with X509/token credentials
+	PublicClient *http.Client   // HTTP client without credentials, e.g. to talk to arbitrary hosts
+	Mux          *http.ServeMux // HTTP server of the exporter, collector may add its own handlers
+	Verbose      bool           // verbose output
+}
+
+// Config represents configuration of the collector obtained from its flags
+type Config interface {
+	// Namespace returns namespace of collector metrics
+	Namespace() string
+	// NewCollector creates prometheus collector, nil collector means that
+	// collector only provides its own HTTP handlers
+	NewCollector(env *Env) (prometheus.Collector, error)
+}
+
+// AuthConfig is implemented by collector configurations which adjust options
+// of credential manager of standalone exporter
+type AuthConfig interface {
+	AuthOptions(opts *auth.Options)
+}
+
+// TargetConfig is implemented by collector configurations which describe
+// their target by other means than uri option
+type TargetConfig interface {
+	Target() string
+}
+
+// StatusCollector is implemented by collectors which report outcome of
+// their last scrape of the source
+type StatusCollector interface {
+	LastScrape() scrape.Status
+}
+
+// Collector describes collector which can be run by exporter
+type Collector struct {
+	Name          string                        // name of the collector, used as subcommand of cmsweb-exporter
+	Description   string                        // short description of the collector
+	AddressFlag   string                        // name of listening address flag of standalone exporter
+	Address       string                        // default listening address of standalone exporter
+	NamespaceFlag string                        // name of namespace flag, empty if collector uses fixed namespace
+	TimeoutFlag   string                        // name of timeout flag, if empty common timeout flag is used
+	Auth          bool                          // collector talks to services which require credentials
+	Flags         func(fs *flag.FlagSet) Config // registers collector flags
+}
+
+// helper function to return name of timeout flag of the collector
+func (c Collector) timeoutFlag() string {
+	if c.TimeoutFlag != "" {
+		return c.TimeoutFlag
+	}
+	return "timeout"
+}
+
+// instance represents collector along with its configuration
+type instance struct {
+	collector    Collector
+	config       Config
+	flags        *flag.FlagSet
+	pollInterval *int
+	timeout      *int
+}
+
+// helper function to register flags of given collector
+func newInstance(c Collector, fs *flag.FlagSet) *instance {
+	inst := &instance{
+		collector:    c,
+		config:       c.Flags(fs),
+		flags:        fs,
+		pollInterval: fs.Int("pollInterval", 0, "poll the source every given number of seconds in background and serve scrapes from cache, 0 means poll on every scrape"),
+	}
+	if c.TimeoutFlag == "" {
+		inst.timeout = fs.Int("timeout", 0, "timeout of HTTP requests in seconds, 0 means no timeout")
+	}
+	return inst
+}
+
+// helper function to return target of the collector
+func (i *instance) target() string {
+	if tc, ok := i.config.(TargetConfig); ok {
+		return tc.Target()
+	}
+	if f := i.flags.Lookup("uri"); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// helper function to create collector within given environment
+func (i *instance) newCollector(env *Env) (collector prometheus.Collector, err error) {
+	defer func() {
+		// collectors panic on registration of HTTP handler which is already
+		// registered by another collector, e.g. two http collectors with
+		// the same probe endpoint
+		if r := recover(); r != nil {
+			collector, err = nil, fmt.Errorf("collector %s: %v", i.collector.Name, r)
+		}
+	}()
+	if i.timeout != nil && *i.timeout > 0 {
+		timeout := time.Duration(*i.timeout) * time.Second
+		client, public := *env.Client, *env.PublicClient
+		client.Timeout, public.Timeout = timeout, timeout
+		e := *env
+		e.Client, e.PublicClient = &client, &public
+		env = &e
+	}
+	collector, err = i.config.NewCollector(env)
+	if err != nil {
+		return nil, fmt.Errorf("collector %s: %v", i.collector.Name, err)
+	}
+	return collector, nil
+}
+
+// helper function to create collector and register it within given generation
+func (i *instance) register(g *generation, env *Env) error {
+	collector, err := i.newCollector(env)
+	if err != nil {
+		return err
+	}
+	t := &target{name: i.collector.Name, namespace: i.config.Namespace(), target: i.target()}
+	g.targets = append(g.targets, t)
+	if collector == nil {
+		return nil
+	}
+	if sc, ok := collector.(StatusCollector); ok {
+		t.status = sc
+	}
+	interval := time.Duration(*i.pollInterval) * time.Second
+	wrapped := cache.Wrap(i.config.Namespace(), collector, interval)
+	if c, ok := wrapped.(*cache.Collector); ok {
+		g.stops = append(g.stops, c.Stop)
+	}
+	if err := g.add(wrapped); err != nil {
+		return fmt.Errorf("collector %s: %v", i.collector.Name, err)
+	}
+	return nil
+}
+
+// helper function to register flags of credential manager
+func authFlags(fs *flag.FlagSet) *auth.Options {
+	opts := &auth.Options{}
+	fs.StringVar(&opts.ProxyFile, "proxyfile", "", "proxy file name")
+	fs.StringVar(&opts.CACert, "cacert", "", "CA bundle file to verify server certificates")
+	fs.StringVar(&opts.CAPath, "capath", auth.DefaultCAPath, "directory with CA certificates to verify server certificates")
+	fs.BoolVar(&opts.Insecure, "insecure", false, "skip verification of server certificates")
+	fs.StringVar(&opts.Token.TokenFile, "tokenfile", "", "file with bearer token to use")
+	fs.StringVar(&opts.Token.TokenURL, "tokenURL", "", "token endpoint to obtain bearer token via client credentials flow")
+	fs.StringVar(&opts.Token.ClientID, "clientID", "", "client id of client credentials flow")
+	fs.StringVar(&opts.Token.ClientSecretFile, "clientSecretFile", "", "file with client secret of client credentials flow")
+	fs.StringVar(&opts.Token.Scope, "tokenScope", "", "scopes to request for bearer token")
+	fs.StringVar(&opts.Token.Audience, "tokenAudience", "", "audience to request for bearer token")
+	fs.Func("tokenHosts", "comma separated list of additional hosts which receive bearer token, by default it is sent only to hosts of collector targets", func(value string) error {
+		for _, host := range strings.Split(value, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				opts.Token.Hosts = append(opts.Token.Hosts, host)
+			}
+		}
+		return nil
+	})
+	return opts
+}
+
+// helper function to adjust options of credential manager according to
+// given collectors, in multi-collector mode they share single manager,
+// therefore the longest connection timeout is used and keep-alives are
+// disabled if some collector asks for it, while collectors which use X509
+// certificates and collectors which do not can't be combined
+func authOptions(opts *auth.Options, insts []*instance) error {
+	base := *opts
+	var certs, noCerts []string
+	for _, inst := range insts {
+		if !inst.collector.Auth {
+			continue
+		}
+		o := base
+		if ac, ok := inst.config.(AuthConfig); ok {
+			ac.AuthOptions(&o)
+		}
+		if o.NoCerts {
+			noCerts = append(noCerts, inst.collector.Name)
+		} else {
+			certs = append(certs, inst.collector.Name)
+		}
+		if o.Timeout > opts.Timeout {
+			opts.Timeout = o.Timeout
+		}
+		opts.DisableKeepAlives = opts.DisableKeepAlives || o.DisableKeepAlives
+	}
+	if len(certs) > 0 && len(noCerts) > 0 {
+		return fmt.Errorf("collector %s does not use X509 certificates while collector %s does, they can't share credential manager", noCerts[0], certs[0])
+	}
+	opts.NoCerts = len(noCerts) > 0
+	return nil
+}
+
+// helper function to return hosts of targets of collectors which talk to
+// services with credentials, bearer token is sent only to these hosts
+func tokenHosts(insts []*instance) []string {
+	var hosts []string
+	for _, inst := range insts {
+		if !inst.collector.Auth {
+			continue
+		}
+		f := inst.flags.Lookup("uri")
+		if f == nil {
+			continue
+		}
+		if u, err := url.Parse(f.Value.String()); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	return hosts
+}
+
+// helper function to setup log flags, verbose mode adds file name and line number
+func setLogFlags(verbose bool) {
+	if verbose {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	} else {
+		log.SetFlags(log.LstdFlags)
+	}
+}
+
+// Run runs given collector as standalone exporter with given command line arguments
+func Run(c Collector, name string, args []string) error {
+	return run(func(handling flag.ErrorHandling) (*settings, error) {
+		return standaloneSettings(c, name, args, handling)
+	})
+}
+
+// helper function to obtain settings of standalone exporter from command
+// line arguments and configuration file
+func standaloneSettings(c Collector, name string, args []string, handling flag.ErrorHandling) (*settings, error) {
+	fs := flag.NewFlagSet(name, handling)
+	config := fs.String("config", "", "YAML configuration file, command line options override its values")
+	configCheck := fs.Bool("config.check", false, "validate configuration file and exit")
+	address := fs.String(c.AddressFlag, c.Address, "address to expose metrics on web interface.")
+	endpoint := fs.String("endpoint", "/metrics", "Path under which to expose metrics.")
+	reloadTokenFile := fs.String("reloadTokenFile", "", "file with bearer token which enables POST /-/reload endpoint")
+	webConfig := fs.String("webConfig", "", "web configuration file with TLS and basic authentication settings")
+	verbose := fs.Bool("verbose", false, "verbose output")
+	showVersion := fs.Bool("version", false, "print version information and exit")
+	var opts *auth.Options
+	if c.Auth {
+		opts = authFlags(fs)
+	}
+	inst := newInstance(c, fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *showVersion {
+		fmt.Println(name, version.Info())
+		os.Exit(0)
+	}
+	if *config != "" {
+		err := configure(c, fs, *config)
+		if *configCheck {
+			if err == nil && *webConfig != "" {
+				_, err = web.Load(*webConfig)
+			}
+			if err == nil {
+				err = check([]*instance{inst})
+			}
+			exitCheck(*config, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.Auth {
+		opts.Namespace = inst.config.Namespace()
+		if err := authOptions(opts, []*instance{inst}); err != nil {
+			return nil, err
+		}
+	}
+	return &settings{
+		name:            name,
+		address:         *address,
+		endpoint:        *endpoint,
+		namespace:       inst.config.Namespace(),
+		reloadTokenFile: *reloadTokenFile,
+		webConfigFile:   *webConfig,
+		verbose:         *verbose,
+		opts:            opts,
+		insts:           []*instance{inst},
+	}, nil
+}
+
+// helper function to apply configuration file to flags of standalone
+// exporter, only settings of given collector are taken from the file
+func configure(c Collector, fs *flag.FlagSet, fname string) error {
+	cfg, err := loadConfig(fname)
+	if err != nil {
+		return err
+	}
+	// server settings which are not applicable to collector, e.g.
+	// credentials of collectors which do not need them, are skipped
+	if err := applyValues(fs, cfg.values(c.AddressFlag), false); err != nil {
+		return err
+	}
+	var entries []CollectorConfig
+	for _, cc := range cfg.Collectors {
+		if cc.Name == c.Name {
+			entries = append(entries, cc)
+		}
+	}
+	if len(entries) == 0 {
+		if len(cfg.Collectors) > 0 {
+			return fmt.Errorf("%s: no %s collector is configured", fname, c.Name)
+		}
+		return nil
+	}
+	if len(entries) > 1 {
+		return fmt.Errorf("%s: several %s collectors are configured, please use cmsweb-exporter to run them", fname, c.Name)
+	}
+	values, err := entries[0].values(c)
+	if err == nil {
+		err = applyValues(fs, values, true)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", fname, err)
+	}
+	return nil
+}
+
+// Main runs given collector as standalone exporter with arguments of the
+// program, it is used by main functions of individual exporters
+func Main(c Collector) {
+	if err := Run(c, os.Args[0], os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,348 @@
+package exporter
+
+// HTTP server of exporters with hot reload of configuration.
+//
+// Collectors created from one configuration form a generation with its own
+// registry and HTTP handlers. On SIGHUP or POST /-/reload the configuration
+// is re-read, new generation is created and atomically replaces the current
+// one, if new configuration is invalid the current generation is kept.
+
+import (
+	"context"
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/auth"
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/dmwm/cmsweb-exporters/version"
+	"github.com/dmwm/cmsweb-exporters/web"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// shutdownTimeout defines how long server waits for in-flight requests on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// settings represents exporter settings obtained from command line
+// arguments and configuration file
+type settings struct {
+	name            string        // name of the exporter
+	address         string        // address to expose metrics on
+	endpoint        string        // path under which to expose metrics
+	namespace       string        // namespace of exporter metrics
+	reloadTokenFile string        // file with bearer token of reload endpoint
+	webConfigFile   string        // web configuration file of HTTP server
+	verbose         bool          // verbose output
+	opts            *auth.Options // options of credential manager, nil if it is not needed
+	insts           []*instance   // collectors to run
+}
+
+// loader obtains exporter settings, it is called on start and on every reload
+type loader func(handling flag.ErrorHandling) (*settings, error)
+
+// generation represents collectors created from one configuration
+type generation struct {
+	registry   *prometheus.Registry // registry used to detect duplicated metrics
+	collectors []prometheus.Collector
+	mux        *http.ServeMux
+	targets    []*target
+	stops      []func() // stop background polling of collectors
+}
+
+// helper function to add collector to the generation
+func (g *generation) add(c prometheus.Collector) error {
+	if err := g.registry.Register(c); err != nil {
+		return err
+	}
+	g.collectors = append(g.collectors, c)
+	return nil
+}
+
+// helper function to gather metrics of the generation within context of
+// the scrape, collectors are registered with registry of the scrape which
+// passes the context to them
+func (g *generation) gather(ctx context.Context) ([]*dto.MetricFamily, error) {
+	reg := prometheus.NewRegistry()
+	for _, c := range g.collectors {
+		if err := reg.Register(scrape.WithContext(ctx, c)); err != nil {
+			return nil, err
+		}
+	}
+	return reg.Gather()
+}
+
+// helper function to create collectors of given settings
+func newGeneration(s *settings) (g *generation, err error) {
+	g = &generation{registry: prometheus.NewRegistry(), mux: http.NewServeMux()}
+	defer func() {
+		// collectors may panic on registration of duplicate HTTP handlers
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		if err != nil {
+			g.stop()
+			g = nil
+		}
+	}()
+	env := &Env{Client: &http.Client{}, PublicClient: &http.Client{}, Mux: g.mux, Verbose: s.verbose}
+	if s.opts != nil {
+		opts := *s.opts
+		opts.Token.Hosts = append(tokenHosts(s.insts), opts.Token.Hosts...)
+		mgr := auth.NewManager(opts)
+		if err := g.add(mgr); err != nil {
+			return g, err
+		}
+		env.Client = mgr.Client()
+		env.PublicClient = mgr.PublicClient()
+	}
+	for _, inst := range s.insts {
+		if err := inst.register(g, env); err != nil {
+			return g, err
+		}
+	}
+	// build information is reported within namespace of every collector
+	namespaces := make(map[string]bool)
+	for _, t := range g.targets {
+		if namespaces[t.namespace] {
+			continue
+		}
+		namespaces[t.namespace] = true
+		if err := g.add(version.NewCollector(t.namespace)); err != nil {
+			return g, err
+		}
+	}
+	return g, nil
+}
+
+// helper function to stop background activity of the generation
+func (g *generation) stop() {
+	for _, stop := range g.stops {
+		stop()
+	}
+}
+
+// server represents exporter HTTP server
+type server struct {
+	load            loader
+	name            string
+	address         string
+	endpoint        string
+	reloadTokenFile string
+	webConfigFile   string
+
+	mutex      sync.RWMutex // protects current generation
+	current    *generation
+	reloadLock sync.Mutex // serializes reloads
+
+	success   prometheus.Gauge
+	timestamp prometheus.Gauge
+}
+
+// helper function to load exporter settings and run its HTTP server
+func run(load loader) error {
+	s, err := load(flag.ExitOnError)
+	if err != nil {
+		return err
+	}
+	setLogFlags(s.verbose)
+	g, err := newGeneration(s)
+	if err != nil {
+		return err
+	}
+	srv := &server{
+		load:            load,
+		name:            s.name,
+		address:         s.address,
+		endpoint:        s.endpoint,
+		reloadTokenFile: s.reloadTokenFile,
+		webConfigFile:   s.webConfigFile,
+		current:         g,
+		success: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: s.namespace,
+			Name:      "config_last_reload_successful",
+			Help:      "Whether last configuration reload was successful",
+		}),
+		timestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: s.namespace,
+			Name:      "config_last_reload_timestamp_seconds",
+			Help:      "Timestamp of last successful configuration reload",
+		}),
+	}
+	srv.success.Set(1)
+	srv.timestamp.SetToCurrentTime()
+	prometheus.MustRegister(srv.success, srv.timestamp)
+	go srv.handleSignals()
+	return srv.serve()
+}
+
+// helper function to start HTTP server, the server is shut down on SIGTERM
+// or SIGINT signals
+func (s *server) serve() error {
+	mux := http.NewServeMux()
+	mux.Handle(s.endpoint, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, http.HandlerFunc(s.metricsHandler)))
+	if s.reloadTokenFile != "" {
+		mux.HandleFunc("/-/reload", s.reloadHandler)
+	}
+	mux.HandleFunc("/healthz", s.healthzHandler)
+	mux.HandleFunc("/readyz", s.readyzHandler)
+	// other requests are served by handlers of current collectors
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			s.landingHandler(w, r)
+			return
+		}
+		s.generation().mux.ServeHTTP(w, r)
+	}))
+
+	// base context of all requests, it is canceled to abort in-flight
+	// scrapes if they are not finished within shutdown timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := &http.Server{
+		Addr:        s.address,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+		sig := <-ch
+		log.Printf("received %v, shutting down", sig)
+		sctx, scancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer scancel()
+		if err := server.Shutdown(sctx); err != nil {
+			log.Printf("in-flight requests are not finished: %v, cancel them", err)
+			cancel()
+			// let canceled scrapes reply before connections are closed
+			cctx, ccancel := context.WithTimeout(context.Background(), time.Second)
+			defer ccancel()
+			if err := server.Shutdown(cctx); err != nil {
+				server.Close()
+			}
+		}
+		s.generation().stop()
+	}()
+
+	log.Printf("Starting Server: %s", s.address)
+	err := web.ListenAndServe(server, s.webConfigFile)
+	if err == http.ErrServerClosed {
+		<-done
+		log.Println("server is stopped")
+		return nil
+	}
+	return err
+}
+
+// helper function to serve metrics of the exporter, collectors are called
+// within context of the scrape request
+func (s *server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := scrape.Context(r)
+	defer cancel()
+	gatherer := prometheus.Gatherers{prometheus.DefaultGatherer, s.gatherer(ctx)}
+	promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// helper function to return gatherer of current collectors within given context
+func (s *server) gatherer(ctx context.Context) prometheus.Gatherer {
+	g := s.generation()
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return g.gather(ctx)
+	})
+}
+
+// helper function to return current generation of collectors
+func (s *server) generation() *generation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.current
+}
+
+// helper function to reload configuration on SIGHUP
+func (s *server) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		log.Println("received SIGHUP, reloading configuration")
+		s.reload()
+	}
+}
+
+// helper function to handle POST /-/reload requests, the request should
+// provide bearer token stored in reload token file
+func (s *server) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := os.ReadFile(s.reloadTokenFile)
+	if err != nil {
+		log.Printf("unable to read reload token file: %v", err)
+		http.Error(w, "unable to verify token", http.StatusInternalServerError)
+		return
+	}
+	token := strings.TrimSpace(string(data))
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := s.reload(); err != nil {
+		http.Error(w, fmt.Sprintf("failed to reload configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
+
+// helper function to reload configuration and replace current collectors
+func (s *server) reload() error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	err := s.swap()
+	if err != nil {
+		log.Printf("unable to reload configuration: %v", err)
+		s.success.Set(0)
+		return err
+	}
+	log.Println("configuration reloaded")
+	s.success.Set(1)
+	s.timestamp.SetToCurrentTime()
+	return nil
+}
+
+// helper function to create collectors of new configuration and atomically
+// replace current ones with them
+func (s *server) swap() error {
+	settings, err := s.load(flag.ContinueOnError)
+	if err != nil {
+		return err
+	}
+	if settings.address != s.address || settings.endpoint != s.endpoint ||
+		settings.reloadTokenFile != s.reloadTokenFile || settings.webConfigFile != s.webConfigFile {
+		log.Println("WARNING: changes of listen address, metrics path, reload token and web configuration files require restart")
+	}
+	g, err := newGeneration(settings)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	old := s.current
+	s.current = g
+	s.mutex.Unlock()
+	old.stop()
+	setLogFlags(settings.verbose)
+	return nil
+}
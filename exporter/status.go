@@ -0,0 +1,115 @@
+package exporter
+
+// Landing page, liveness and readiness endpoints of exporters.
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/scrape"
+	"github.com/dmwm/cmsweb-exporters/version"
+)
+
+// target represents collector along with its target shown on landing page
+type target struct {
+	name      string
+	namespace string
+	target    string
+	status    StatusCollector // nil if collector does not report its scrapes
+}
+
+// targetStatus represents state of the target shown on landing page
+type targetStatus struct {
+	Name      string
+	Namespace string
+	Target    string
+	Scraped   bool
+	Time      string
+	Duration  string
+	Outcome   string
+	Failed    bool
+}
+
+// helper function to return state of the target
+func (t *target) state() targetStatus {
+	ts := targetStatus{Name: t.name, Namespace: t.namespace, Target: t.target}
+	if t.status == nil {
+		return ts
+	}
+	last := t.status.LastScrape()
+	if last.Time.IsZero() {
+		return ts
+	}
+	ts.Scraped = true
+	ts.Time = last.Time.Format(time.RFC3339)
+	ts.Duration = last.Duration.Round(time.Millisecond).String()
+	ts.Outcome = "success"
+	if last.Err != nil {
+		ts.Failed = true
+		ts.Outcome = fmt.Sprintf("%s: %v", scrape.Reason(last.Err), last.Err)
+	}
+	return ts
+}
+
+// landing page template
+var landingTemplate = template.Must(template.New("landing").Parse(`<html>
+<head><title>{{.Name}}</title></head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Version: {{.Version}}</p>
+<p><a href="{{.Endpoint}}">Metrics</a> | <a href="/healthz">Health</a> | <a href="/readyz">Readiness</a></p>
+<table border="1" cellpadding="4">
+<tr><th>Collector</th><th>Namespace</th><th>Target</th><th>Last scrape</th><th>Duration</th><th>Outcome</th></tr>
+{{range .Targets}}<tr><td>{{.Name}}</td><td>{{.Namespace}}</td><td>{{.Target}}</td>
+{{if .Scraped}}<td>{{.Time}}</td><td>{{.Duration}}</td><td>{{if .Failed}}<font color="red">{{.Outcome}}</font>{{else}}{{.Outcome}}{{end}}</td>
+{{else}}<td colspan="3">not scraped yet</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// helper function to serve landing page
+func (s *server) landingHandler(w http.ResponseWriter, r *http.Request) {
+	var targets []targetStatus
+	for _, t := range s.generation().targets {
+		targets = append(targets, t.state())
+	}
+	data := struct {
+		Name     string
+		Version  string
+		Endpoint string
+		Targets  []targetStatus
+	}{filepath.Base(s.name), version.Info(), s.endpoint, targets}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := landingTemplate.Execute(w, data); err != nil {
+		log.Printf("unable to render landing page: %v", err)
+	}
+}
+
+// helper function to serve liveness probe, the exporter is alive as long
+// as it serves HTTP requests
+func (s *server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "OK")
+}
+
+// helper function to serve readiness probe, the exporter is ready if last
+// scrape of every source succeeded, sources which were not scraped yet are
+// considered ready
+func (s *server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	var failed []string
+	for _, t := range s.generation().targets {
+		if st := t.state(); st.Failed {
+			failed = append(failed, fmt.Sprintf("%s: %s", t.name, st.Outcome))
+		}
+	}
+	if len(failed) > 0 {
+		http.Error(w, strings.Join(failed, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
@@ -0,0 +1,165 @@
+package jsonpath
+
+// Minimal JSONPath implementation for JSON documents decoded by encoding/json.
+//
+// Supported syntax:
+//   - $ root of the document (optional)
+//   - .key or ['key'] child of an object
+//   - [N] element of an array, negative index counts from the end
+//   - [*] or .* all elements of an array or all values of an object
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// token kinds
+const (
+	keyToken = iota
+	indexToken
+	wildcardToken
+)
+
+// token represents single step of JSONPath expression
+type token struct {
+	kind  int
+	key   string
+	index int
+}
+
+// helper function to apply token to given JSON node
+func (t token) apply(node interface{}) []interface{} {
+	switch t.kind {
+	case keyToken:
+		if m, ok := node.(map[string]interface{}); ok {
+			if v, ok := m[t.key]; ok {
+				return []interface{}{v}
+			}
+		}
+	case indexToken:
+		if arr, ok := node.([]interface{}); ok {
+			idx := t.index
+			if idx < 0 {
+				idx += len(arr)
+			}
+			if idx >= 0 && idx < len(arr) {
+				return []interface{}{arr[idx]}
+			}
+		}
+	case wildcardToken:
+		switch v := node.(type) {
+		case []interface{}:
+			return v
+		case map[string]interface{}:
+			// use sorted keys to provide stable order of values
+			var keys []string
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			var out []interface{}
+			for _, k := range keys {
+				out = append(out, v[k])
+			}
+			return out
+		}
+	}
+	return nil
+}
+
+// Path represents compiled JSONPath expression
+type Path struct {
+	expr   string
+	tokens []token
+}
+
+// String returns original JSONPath expression
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Wildcard reports whether expression contains wildcards, i.e. it may match
+// any number of values
+func (p *Path) Wildcard() bool {
+	for _, t := range p.tokens {
+		if t.kind == wildcardToken {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile parses given JSONPath expression
+func Compile(expr string) (*Path, error) {
+	path := &Path{expr: expr}
+	s := strings.TrimSpace(expr)
+	s = strings.TrimPrefix(s, "$")
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end == -1 {
+				end = len(s)
+			}
+			name := s[:end]
+			if name == "" {
+				return nil, fmt.Errorf("empty key in JSONPath %q", expr)
+			}
+			if strings.Contains(name, "]") {
+				return nil, fmt.Errorf("unexpected ] in JSONPath %q", expr)
+			}
+			if name == "*" {
+				path.tokens = append(path.tokens, token{kind: wildcardToken})
+			} else {
+				path.tokens = append(path.tokens, token{kind: keyToken, key: name})
+			}
+			s = s[end:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("missing ] in JSONPath %q", expr)
+			}
+			sel := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			if sel == "*" {
+				path.tokens = append(path.tokens, token{kind: wildcardToken})
+			} else if len(sel) > 1 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0] {
+				path.tokens = append(path.tokens, token{kind: keyToken, key: sel[1 : len(sel)-1]})
+			} else {
+				idx, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q in JSONPath %q", sel, expr)
+				}
+				path.tokens = append(path.tokens, token{kind: indexToken, index: idx})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q in JSONPath %q", s[0], expr)
+		}
+	}
+	return path, nil
+}
+
+// Get returns all values of given JSON document matched by the expression
+func (p *Path) Get(doc interface{}) []interface{} {
+	nodes := []interface{}{doc}
+	for _, t := range p.tokens {
+		var next []interface{}
+		for _, node := range nodes {
+			next = append(next, t.apply(node)...)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Get returns all values of given JSON document matched by given expression
+func Get(doc interface{}, expr string) ([]interface{}, error) {
+	path, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return path.Get(doc), nil
+}
@@ -0,0 +1,136 @@
+package jsonpath
+
+// Tests of minimal JSONPath implementation.
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// test document used by all tests
+const testDoc = `{
+	"status": "ok",
+	"a.b": 1,
+	"nested": {"x": 1, "y": 2},
+	"services": [
+		{"name": "dbs", "requests": 10, "tags": ["prod", "global"]},
+		{"name": "das", "requests": 20, "tags": []},
+		{"name": "reqmgr", "requests": 30}
+	]
+}`
+
+// helper function to decode test document
+func decode(t *testing.T, data string) interface{} {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		t.Fatalf("unable to decode test document: %v", err)
+	}
+	return doc
+}
+
+// TestGet tests evaluation of valid expressions
+func TestGet(t *testing.T) {
+	doc := decode(t, testDoc)
+	tests := []struct {
+		expr string
+		want []interface{}
+	}{
+		{"$", []interface{}{doc}},
+		{"", []interface{}{doc}},
+		{"$.status", []interface{}{"ok"}},
+		{".status", []interface{}{"ok"}},
+		{" $.status ", []interface{}{"ok"}},
+		{"$.nested.y", []interface{}{2.0}},
+		// quoted keys
+		{"$['status']", []interface{}{"ok"}},
+		{`$["status"]`, []interface{}{"ok"}},
+		{"$['a.b']", []interface{}{1.0}},
+		{"$['nested']['x']", []interface{}{1.0}},
+		{"$.services[0]['name']", []interface{}{"dbs"}},
+		// array indexes
+		{"$.services[1].name", []interface{}{"das"}},
+		{"$.services[ 2 ].name", []interface{}{"reqmgr"}},
+		{"$.services[-1].name", []interface{}{"reqmgr"}},
+		{"$.services[-3].name", []interface{}{"dbs"}},
+		{"$.services[0].tags[-1]", []interface{}{"global"}},
+		// wildcards on arrays and objects
+		{"$.services[*].name", []interface{}{"dbs", "das", "reqmgr"}},
+		{"$.services.*.requests", []interface{}{10.0, 20.0, 30.0}},
+		{"$.nested.*", []interface{}{1.0, 2.0}},
+		{"$.nested[*]", []interface{}{1.0, 2.0}},
+		{"$.services[*].tags[*]", []interface{}{"prod", "global"}},
+		{"$.services[*].tags[0]", []interface{}{"prod"}},
+		// no matches
+		{"$.missing", nil},
+		{"$.services[3]", nil},
+		{"$.services[-4]", nil},
+		{"$.status[0]", nil},
+		{"$.status.*", nil},
+		{"$.services.name", nil},
+		{"$.services[*].missing", nil},
+	}
+	for _, tt := range tests {
+		got, err := Get(doc, tt.expr)
+		if err != nil {
+			t.Errorf("Get(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Get(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+// TestCompileErrors tests rejection of malformed expressions
+func TestCompileErrors(t *testing.T) {
+	tests := []string{
+		"$.",
+		"$..status",
+		"$.services[0",
+		"$.services[]",
+		"$.services[abc]",
+		"$.services[1.5]",
+		"$['status]",
+		"$[']",
+		"status",
+		"$status",
+		"$.services]",
+	}
+	for _, expr := range tests {
+		if p, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q) = %v, expected error", expr, p.tokens)
+		}
+		if _, err := Get(nil, expr); err == nil {
+			t.Errorf("Get(%q) expected error", expr)
+		}
+	}
+}
+
+// TestPath tests attributes of compiled expressions
+func TestPath(t *testing.T) {
+	tests := []struct {
+		expr     string
+		wildcard bool
+	}{
+		{"$", false},
+		{"$.services[0].name", false},
+		{"$['a.b']", false},
+		{"$.services[*].name", true},
+		{"$.nested.*", true},
+		{"$['*']", false},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if p.String() != tt.expr {
+			t.Errorf("Compile(%q).String() = %q", tt.expr, p.String())
+		}
+		if p.Wildcard() != tt.wildcard {
+			t.Errorf("Compile(%q).Wildcard() = %v, want %v", tt.expr, p.Wildcard(), tt.wildcard)
+		}
+	}
+}
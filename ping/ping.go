@@ -0,0 +1,102 @@
+package ping
+
+// cmsweb-ping - Go implementation of ping functionality for cmsweb services based on hmac
+//
+// Copyright (c) 2020 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+
+	"github.com/dmwm/cmsweb-exporters/version"
+)
+
+// Main pings cmsweb service with given command line arguments
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var url string
+	fs.StringVar(&url, "url", "", "service url")
+	var authz string
+	fs.StringVar(&authz, "authz", "", "authz file")
+	var verbose int
+	fs.IntVar(&verbose, "verbose", 0, "verbose level")
+	var showVersion bool
+	fs.BoolVar(&showVersion, "version", false, "print version information and exit")
+	fs.Parse(args)
+	if showVersion {
+		fmt.Println(name, version.Info())
+		return
+	}
+	res, err := Run(url, authz, verbose)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println(res)
+}
+
+// Run pings given cmsweb service url using hmac from given authz file and
+// returns status of the response
+func Run(rurl, authz string, verbose int) (string, error) {
+	req, err := http.NewRequest("GET", rurl, nil)
+	if err != nil {
+		return "", err
+	}
+	headers := make(map[string]string)
+	headers["cms-auth-status"] = "OK"
+	headers["cms-authn-method"] = "PingMonitor"
+	headers["cms-authn-login"] = "ping-monitor"
+	headers["cms-authn-name"] = "Ping Monitor"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	// sorted list of cms headers
+	hkeys := []string{"cms-authn-login", "cms-authn-method", "cms-authn-name"}
+	var prefix, suffix string
+	for _, key := range hkeys {
+		if val, ok := headers[key]; ok {
+			prefix += fmt.Sprintf("h%xv%x", len(key), len(val))
+			suffix += fmt.Sprintf("%s%s", key, val)
+		}
+	}
+	// read hkey from given file
+	hkey, err := ioutil.ReadFile(authz)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read, file: %s, error: %v", authz, err)
+	}
+
+	value := []byte(fmt.Sprintf("%s#%s", prefix, suffix))
+	sha1hex := hmac.New(sha1.New, hkey)
+	sha1hex.Write(value)
+	hmacValue := fmt.Sprintf("%x", sha1hex.Sum(nil))
+	req.Header.Set("cms-authn-hmac", hmacValue)
+	req.Header.Set("Accept", "*/*")
+
+	if verbose > 0 {
+		dump, err := httputil.DumpRequestOut(req, true)
+		if err == nil {
+			fmt.Println("request: ", string(dump))
+		}
+	}
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Unable to get response from %s, error: %s", rurl, err)
+	}
+	defer resp.Body.Close()
+	if verbose > 0 {
+		dump, err := httputil.DumpResponse(resp, true)
+		if err == nil {
+			fmt.Println("response:", string(dump))
+		}
+	}
+	return resp.Status, nil
+}
@@ -3,6 +3,9 @@
 # process_monitor.sh script starts new process_exporter for given
 # pattern and prefix. It falls into infinitive loop with given interval
 # and restart process_exporter for our pattern process.
+# NOTE: process_exporter can find processes itself via -pidfile, -name,
+# -cmdline and -user options and follow their restarts, e.g.
+# process_exporter -pidfile /data/srv/state/reqmgr2/pid -prefix reqmgr2
 
 usage="Usage: process_monitor.sh <pattern> <prefix> <address> <interval>"
 if [ $# -ne 4 ]; then
@@ -0,0 +1,217 @@
+package scrape
+
+// Standard set of scrape metrics shared by cmsweb exporters.
+//
+// Every exporter reports the following metrics:
+//   - <namespace>_up whether last scrape of the source was successful
+//   - <namespace>_scrape_duration_seconds duration of last scrape
+//   - <namespace>_scrape_errors_total{reason} number of failed scrapes
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmwm/cmsweb-exporters/auth"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reasons of failed scrapes
+const (
+	ReasonConnect    = "connect"     // source is not reachable
+	ReasonTLS        = "tls"         // TLS handshake or certificate verification failed
+	ReasonHTTPStatus = "http-status" // source returned unexpected HTTP status
+	ReasonDecode     = "decode"      // response of the source can't be decoded
+	ReasonOther      = "other"       // any other failure
+)
+
+// Reasons lists all reasons of failed scrapes
+var Reasons = []string{ReasonConnect, ReasonTLS, ReasonHTTPStatus, ReasonDecode, ReasonOther}
+
+// Error represents failed scrape along with its reason
+type Error struct {
+	Reason string
+	Err    error
+}
+
+// Error implements error interface
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errorf creates new scrape error with given reason
+func Errorf(reason, format string, args ...interface{}) error {
+	return &Error{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// Reason returns reason of given scrape error
+func Reason(err error) string {
+	var serr *Error
+	if errors.As(err, &serr) {
+		return serr.Reason
+	}
+	var rerr tls.RecordHeaderError
+	if auth.IsVerificationError(err) || errors.As(err, &rerr) || strings.Contains(err.Error(), "tls:") {
+		return ReasonTLS
+	}
+	var jerr *json.SyntaxError
+	var terr *json.UnmarshalTypeError
+	if errors.As(err, &jerr) || errors.As(err, &terr) {
+		return ReasonDecode
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return ReasonConnect
+	}
+	return ReasonOther
+}
+
+// Status represents outcome of the scrape
+type Status struct {
+	Time     time.Time     // start of the scrape, zero if source was not scraped yet
+	Duration time.Duration // duration of the scrape
+	Err      error         // error of failed scrape
+}
+
+// ContextCollector is implemented by collectors which propagate context of
+// the scrape to their requests to the source
+type ContextCollector interface {
+	prometheus.Collector
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// Collect collects metrics of given collector within given context
+func Collect(ctx context.Context, c prometheus.Collector, ch chan<- prometheus.Metric) {
+	if cc, ok := c.(ContextCollector); ok {
+		cc.CollectContext(ctx, ch)
+		return
+	}
+	c.Collect(ch)
+}
+
+// TimeoutOffset defines time subtracted from scrape timeout of Prometheus to
+// let exporter reply before Prometheus gives up the scrape
+const TimeoutOffset = 500 * time.Millisecond
+
+// Context returns context of the scrape request, its deadline is derived
+// from X-Prometheus-Scrape-Timeout-Seconds header if it is provided
+func Context(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := r.Context()
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return context.WithCancel(ctx)
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > 2*TimeoutOffset {
+		timeout -= TimeoutOffset
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// boundCollector collects metrics of collector within given context
+type boundCollector struct {
+	ctx       context.Context
+	collector prometheus.Collector
+}
+
+// Describe implements prometheus.Collector interface
+func (b *boundCollector) Describe(ch chan<- *prometheus.Desc) {
+	b.collector.Describe(ch)
+}
+
+// Collect implements prometheus.Collector interface
+func (b *boundCollector) Collect(ch chan<- prometheus.Metric) {
+	Collect(b.ctx, b.collector, ch)
+}
+
+// WithContext returns collector which collects metrics of given collector
+// within given context, e.g. context of the scrape request
+func WithContext(ctx context.Context, c prometheus.Collector) prometheus.Collector {
+	return &boundCollector{ctx: ctx, collector: c}
+}
+
+// Metrics represents standard scrape metrics of the exporter
+type Metrics struct {
+	up       *prometheus.Desc
+	duration *prometheus.Desc
+	errors   *prometheus.CounterVec
+
+	mutex sync.Mutex
+	last  Status // status of last scrape
+}
+
+// NewMetrics creates scrape metrics for given namespace
+func NewMetrics(namespace string) *Metrics {
+	m := &Metrics{
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "up"),
+			"Whether last scrape of the source was successful",
+			nil,
+			nil),
+		duration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "scrape_duration_seconds"),
+			"Duration of last scrape of the source",
+			nil,
+			nil),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_errors_total",
+			Help:      "Number of failed scrapes of the source by reason",
+		},
+			[]string{"reason"},
+		),
+	}
+	// initialize all reasons to make error rates available from the start
+	for _, r := range Reasons {
+		m.errors.WithLabelValues(r)
+	}
+	return m
+}
+
+// Describe sends descriptors of scrape metrics to given channel
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.up
+	ch <- m.duration
+	m.errors.Describe(ch)
+}
+
+// Collect sends scrape metrics of the scrape started at given time and
+// finished with given error to given channel
+func (m *Metrics) Collect(ch chan<- prometheus.Metric, start time.Time, err error) {
+	elapsed := time.Since(start)
+	up := 1.0
+	if err != nil {
+		up = 0
+		m.errors.WithLabelValues(Reason(err)).Inc()
+	}
+	m.mutex.Lock()
+	m.last = Status{Time: start, Duration: elapsed, Err: err}
+	m.mutex.Unlock()
+	ch <- prometheus.MustNewConstMetric(m.up, prometheus.GaugeValue, up)
+	ch <- prometheus.MustNewConstMetric(m.duration, prometheus.GaugeValue, elapsed.Seconds())
+	m.errors.Collect(ch)
+}
+
+// Last returns status of last scrape
+func (m *Metrics) Last() Status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.last
+}
@@ -0,0 +1,77 @@
+package version
+
+// Build information of cmsweb exporters. Version, git commit and build date
+// are set at build time via ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/dmwm/cmsweb-exporters/version.Version=1.2.3 \
+//	    -X github.com/dmwm/cmsweb-exporters/version.GitCommit=$(git rev-parse HEAD) \
+//	    -X github.com/dmwm/cmsweb-exporters/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// if they are not set, module version, commit and commit time embedded by Go
+// toolchain are used.
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// build information set via ldflags
+var (
+	Version   string // release version, e.g. git tag
+	GitCommit string // git commit of the build
+	BuildDate string // build date in RFC3339 format
+)
+
+// GoVersion defines Go version used to build the binary
+var GoVersion = runtime.Version()
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		if Version == "" && info.Main.Version != "(devel)" {
+			Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if GitCommit == "" {
+					GitCommit = s.Value
+				}
+			case "vcs.time":
+				if BuildDate == "" {
+					BuildDate = s.Value
+				}
+			}
+		}
+	}
+	if Version == "" {
+		Version = "unknown"
+	}
+	if GitCommit == "" {
+		GitCommit = "unknown"
+	}
+	if BuildDate == "" {
+		BuildDate = "unknown"
+	}
+}
+
+// Info returns build information in human readable form
+func Info() string {
+	return fmt.Sprintf("version %s, git commit %s, build date %s, %s", Version, GitCommit, BuildDate, GoVersion)
+}
+
+// NewCollector creates collector of <namespace>_exporter_build_info metric
+func NewCollector(namespace string) prometheus.Collector {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "exporter_build_info",
+		Help:      "Build information of the exporter, value is always 1",
+	},
+		[]string{"version", "commit", "build_date", "goversion"},
+	)
+	gauge.WithLabelValues(Version, GitCommit, BuildDate, GoVersion).Set(1)
+	return gauge
+}
@@ -0,0 +1,210 @@
+package web
+
+// Protection of exporter HTTP server with TLS, client certificates and
+// basic authentication configured via web configuration file, e.g.
+//
+//	tls_server_config:
+//	  cert_file: /etc/grid-security/hostcert.pem
+//	  key_file: /etc/grid-security/hostkey.pem
+//	  client_ca_path: /etc/grid-security/certificates
+//	  allowed_subjects:
+//	    - /DC=ch/DC=cern/OU=computers/CN=cmsmonitoring.cern.ch
+//	basic_auth_users:
+//	  prometheus: $2a$10$mcV0gzMfD8IhiIAn7L4CmuSxBwoniMbIEQm1qlT1DVztb5YCkKW/C
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/dmwm/cmsweb-exporters/auth"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// Config represents web configuration of exporter HTTP server
+type Config struct {
+	TLS   TLSConfig         `yaml:"tls_server_config"` // HTTPS settings
+	Users map[string]string `yaml:"basic_auth_users"`  // user names and bcrypt hashes of their passwords
+}
+
+// TLSConfig represents HTTPS settings of exporter HTTP server
+type TLSConfig struct {
+	CertFile        string   `yaml:"cert_file"`        // server certificate, e.g. host certificate
+	KeyFile         string   `yaml:"key_file"`         // server private key
+	ClientAuthType  string   `yaml:"client_auth_type"` // policy of client certificate verification
+	ClientCAFile    string   `yaml:"client_ca_file"`   // CA bundle to verify client certificates
+	ClientCAPath    string   `yaml:"client_ca_path"`   // CA directory to verify client certificates
+	AllowedSubjects []string `yaml:"allowed_subjects"` // DNs of allowed client certificates, empty means any
+	MinVersion      string   `yaml:"min_version"`      // minimal TLS version, e.g. TLS12
+}
+
+// client certificate policies, names follow Prometheus web configuration
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// supported TLS versions
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// Load reads and validates web configuration file
+func Load(fname string) (*Config, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", fname, err)
+	}
+	for user, hash := range cfg.Users {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s: password of user %s is not bcrypt hash: %v", fname, user, err)
+		}
+	}
+	if _, err := cfg.tlsConfig(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return &cfg, nil
+}
+
+// helper function to check if HTTPS is enabled
+func (c *Config) tlsEnabled() bool {
+	return c.TLS.CertFile != "" || c.TLS.KeyFile != ""
+}
+
+// helper function to create TLS configuration of the server, it returns nil
+// if HTTPS is not enabled
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	t := c.TLS
+	if !c.tlsEnabled() {
+		if t.ClientCAFile != "" || t.ClientCAPath != "" || t.ClientAuthType != "" || len(t.AllowedSubjects) > 0 {
+			return nil, fmt.Errorf("client certificate settings require cert_file and key_file")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load server certificate: %v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if t.MinVersion != "" {
+		version, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %s", t.MinVersion)
+		}
+		cfg.MinVersion = version
+	}
+	if t.ClientCAFile != "" || t.ClientCAPath != "" {
+		pool, err := auth.LoadClientCAs(t.ClientCAFile, t.ClientCAPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if t.ClientAuthType != "" {
+		authType, ok := clientAuthTypes[t.ClientAuthType]
+		if !ok {
+			return nil, fmt.Errorf("unknown client_auth_type %s", t.ClientAuthType)
+		}
+		cfg.ClientAuth = authType
+	}
+	verify := cfg.ClientAuth == tls.VerifyClientCertIfGiven || cfg.ClientAuth == tls.RequireAndVerifyClientCert
+	if verify && cfg.ClientCAs == nil {
+		return nil, fmt.Errorf("client_auth_type %s requires client_ca_file or client_ca_path", t.ClientAuthType)
+	}
+	if len(t.AllowedSubjects) > 0 {
+		if !verify {
+			return nil, fmt.Errorf("allowed_subjects require verification of client certificates")
+		}
+		allowed := make(map[string]bool)
+		for _, dn := range t.AllowedSubjects {
+			allowed[dn] = true
+		}
+		cfg.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			for _, chain := range chains {
+				if len(chain) > 0 && allowed[auth.DistinguishedName(chain[0].Subject)] {
+					return nil
+				}
+			}
+			// no client certificate is allowed by VerifyClientCertIfGiven
+			if len(chains) == 0 && cfg.ClientAuth == tls.VerifyClientCertIfGiven {
+				return nil
+			}
+			return fmt.Errorf("client certificate subject is not allowed")
+		}
+	}
+	return cfg, nil
+}
+
+// endpoints which are not protected by basic authentication: health checks
+// are used by probes of orchestration systems and reload endpoint verifies
+// its own bearer token
+var publicPaths = map[string]bool{
+	"/healthz":  true,
+	"/readyz":   true,
+	"/-/reload": true,
+}
+
+// helper function to protect given handler with basic authentication
+func (c *Config) handler(h http.Handler) http.Handler {
+	if len(c.Users) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if ok {
+			if hash, found := c.Users[user]; found {
+				if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+					h.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="cmsweb-exporters"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// ListenAndServe starts given server according to given web configuration
+// file, plain HTTP is used if file is not provided
+func ListenAndServe(server *http.Server, fname string) error {
+	if fname == "" {
+		return server.ListenAndServe()
+	}
+	cfg, err := Load(fname)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return err
+	}
+	server.Handler = cfg.handler(server.Handler)
+	server.TLSConfig = tlsConfig
+	if tlsConfig == nil {
+		log.Println("WARNING: TLS is not enabled in web configuration")
+		return server.ListenAndServe()
+	}
+	return server.ListenAndServeTLS("", "")
+}